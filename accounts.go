@@ -0,0 +1,112 @@
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+type AccountMapping struct {
+	ItemID     string
+	AccountID  string
+	Name       string
+	Investment bool
+}
+
+// IsInvestmentAccount reports whether an account's activity is returned by
+// the investments endpoints rather than the transactions endpoint
+func IsInvestmentAccount(account Account) bool {
+	return account.Type == "investment"
+}
+
+// AddAccountMappings adds account names to an environment's items in raw
+// config data. The document is edited in place rather than re-encoded from a
+// Config so that comments are preserved and resolved secrets are never
+// written back to the file.
+func AddAccountMappings(data []byte, environment string, mappings []AccountMapping) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, fmt.Errorf("empty config")
+	}
+
+	env := mappingValue(doc.Content[0], environment)
+	if env == nil {
+		return nil, fmt.Errorf("unknown environment: %q", environment)
+	}
+
+	items := mappingValue(env, "items")
+	if items == nil {
+		return nil, fmt.Errorf("environment %q has no items", environment)
+	}
+
+	for _, mapping := range mappings {
+		item := mappingValue(items, mapping.ItemID)
+		if item == nil {
+			return nil, fmt.Errorf("unknown item: %q", mapping.ItemID)
+		}
+
+		key := "transactions"
+		if mapping.Investment {
+			key = "investments"
+		}
+
+		accounts := ensureMapping(item, key)
+		if existing := mappingValue(accounts, mapping.AccountID); existing != nil {
+			existing.SetString(mapping.Name)
+			continue
+		}
+		accounts.Content = append(accounts.Content, stringNode(mapping.AccountID), stringNode(mapping.Name))
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	encoder.Close()
+
+	return buf.Bytes(), nil
+}
+
+// mappingValue returns the value node for a key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ensureMapping returns the mapping value for a key, creating it if the key
+// is missing or null
+func ensureMapping(node *yaml.Node, key string) *yaml.Node {
+	value := mappingValue(node, key)
+	if value != nil && value.Kind == yaml.MappingNode {
+		return value
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if value != nil {
+		*value = *mapping
+		return value
+	}
+	node.Content = append(node.Content, stringNode(key), mapping)
+	return mapping
+}
+
+func stringNode(value string) *yaml.Node {
+	node := &yaml.Node{}
+	node.SetString(value)
+	return node
+}
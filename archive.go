@@ -0,0 +1,157 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	archiveTransactions = "transactions"
+	archiveInvestments  = "investments"
+	archiveHoldings     = "holdings"
+	archiveManifest     = "manifest.json"
+	archiveDirFormat    = "2006-01-02T150405.000Z"
+)
+
+// Archive is a directory of raw plaid responses, saved per item, endpoint and
+// page, from which item data can be rebuilt without requesting it again
+type Archive struct {
+	Dir         string    `json:"-"`
+	Environment string    `json:"environment"`
+	Start       string    `json:"start"` // YYYY-MM-DD, as requested
+	End         string    `json:"end"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+// NewArchive creates an archive in a directory under root named for the
+// current time to the millisecond, recording the requested date range. It
+// fails if the directory already exists.
+func NewArchive(root, environment string, start, end time.Time) (*Archive, error) {
+	now := time.Now().UTC()
+	archive := &Archive{
+		Dir:         filepath.Join(root, now.Format(archiveDirFormat)),
+		Environment: environment,
+		Start:       start.Format(time.DateOnly),
+		End:         end.Format(time.DateOnly),
+		Fetched:     now,
+	}
+
+	err := os.MkdirAll(root, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("create archive root: %w", err)
+	}
+	// fail rather than mix responses with another run's archive
+	err = os.Mkdir(archive.Dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("create archive directory: %w", err)
+	}
+
+	manifest, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal manifest: %w", err)
+	}
+	err = os.WriteFile(filepath.Join(archive.Dir, archiveManifest), manifest, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("write manifest: %w", err)
+	}
+
+	return archive, nil
+}
+
+// OpenArchive reads the manifest of an existing archive
+func OpenArchive(dir string) (*Archive, error) {
+	manifest, err := os.ReadFile(filepath.Join(dir, archiveManifest))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	archive := &Archive{Dir: dir}
+	err = json.Unmarshal(manifest, archive)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal manifest: %w", err)
+	}
+
+	return archive, nil
+}
+
+func (c *Config) archive(itemID, name string, page int, data []byte) error {
+	if c.Archive == nil {
+		return nil
+	}
+	return c.Archive.save(itemID, name, page, data)
+}
+
+func (a *Archive) save(itemID, name string, page int, data []byte) error {
+	dir := filepath.Join(a.Dir, itemID)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("create item directory: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s-%03d.json", name, page)), data, 0600)
+	if err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+
+	return nil
+}
+
+// Items rebuilds item data from the archived responses, as RequestActivity
+// would have returned it
+func (a *Archive) Items() ([]*ItemData, error) {
+	entries, err := os.ReadDir(a.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read archive directory: %w", err)
+	}
+
+	var items []*ItemData
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		item := NewItemData(entry.Name())
+		for _, name := range []string{archiveTransactions, archiveInvestments, archiveHoldings} {
+			// page numbers are zero padded, so glob order is page order
+			pages, err := filepath.Glob(filepath.Join(a.Dir, item.ID, name+"-*.json"))
+			if err != nil {
+				return nil, fmt.Errorf("list item %q %s: %w", item.ID, name, err)
+			}
+
+			for _, page := range pages {
+				data, err := os.ReadFile(page)
+				if err != nil {
+					return nil, fmt.Errorf("read %q: %w", page, err)
+				}
+
+				switch name {
+				case archiveTransactions:
+					var res TransactionsResponse
+					if err = json.Unmarshal(data, &res); err == nil {
+						item.addTransactions(&res)
+					}
+				case archiveInvestments:
+					var res InvestmentTransactionsResponse
+					if err = json.Unmarshal(data, &res); err == nil {
+						item.addInvestments(&res)
+					}
+				case archiveHoldings:
+					var res HoldingsResponse
+					if err = json.Unmarshal(data, &res); err == nil {
+						item.addHoldings(&res)
+					}
+				}
+				if err != nil {
+					return nil, fmt.Errorf("decode %q: %w", page, err)
+				}
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,111 @@
+package ledger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type BudgetPeriod string
+
+const (
+	BudgetMonthly BudgetPeriod = "monthly"
+	BudgetAnnual  BudgetPeriod = "annual"
+)
+
+// Budget limits spending in a category, an account or both. Amounts are
+// outflows, matching plaid's convention of positive amounts for money
+// leaving an account, so refunds and other inflows reduce actual spending.
+type Budget struct {
+	Category string       `yaml:"category" json:"category,omitempty"` // matches subcategories as well
+	Account  string       `yaml:"account" json:"account,omitempty"`   // configured account name
+	Amount   float64      `yaml:"amount" json:"amount"`
+	Period   BudgetPeriod `yaml:"period" json:"period"`
+}
+
+type BudgetStatus struct {
+	Budget
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"` // exclusive
+	Actual    float64   `json:"actual"`
+	Remaining float64   `json:"remaining"`
+	Projected float64   `json:"projected"` // actual spending extrapolated to the end of the period
+	Overspend float64   `json:"overspend"` // projected spending over budget
+}
+
+func (b Budget) Validate() error {
+	switch b.Period {
+	case BudgetMonthly, BudgetAnnual:
+	default:
+		return fmt.Errorf("unknown period: %q", b.Period)
+	}
+	if b.Category == "" && b.Account == "" {
+		return fmt.Errorf("no category or account")
+	}
+	if b.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	return nil
+}
+
+// PeriodBounds returns the budget period containing the given date
+func (b Budget) PeriodBounds(date time.Time) (time.Time, time.Time) {
+	if b.Period == BudgetAnnual {
+		start := time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, date.Location())
+		return start, start.AddDate(1, 0, 0)
+	}
+	start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+func (b Budget) matches(transaction Transaction, delimiter string) bool {
+	if b.Account != "" && transaction.AccountID != b.Account {
+		return false
+	}
+	if b.Category != "" {
+		category := strings.Join(transaction.Category, delimiter)
+		if category != b.Category && !strings.HasPrefix(category, b.Category+delimiter) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewBudgetReport compares spending against each budget for the period
+// containing asOf. Transaction account IDs are expected to hold configured
+// account names, as returned by ReadTransactions.
+func NewBudgetReport(budgets []Budget, transactions []Transaction, delimiter string, asOf time.Time) []BudgetStatus {
+	statuses := make([]BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		start, end := budget.PeriodBounds(asOf)
+		status := BudgetStatus{
+			Budget: budget,
+			Start:  start,
+			End:    end,
+		}
+
+		for _, transaction := range transactions {
+			date := TransactionDate(transaction)
+			if date.Before(start) || date.After(asOf) || !budget.matches(transaction, delimiter) {
+				continue
+			}
+			status.Actual += transaction.Amount
+		}
+
+		elapsed := asOf.Sub(start).Hours()/24 + 1 // count asOf as elapsed
+		total := end.Sub(start).Hours() / 24
+		if elapsed > total {
+			elapsed = total
+		}
+
+		status.Remaining = budget.Amount - status.Actual
+		status.Projected = status.Actual / elapsed * total
+		if status.Projected > budget.Amount {
+			status.Overspend = status.Projected - budget.Amount
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,47 @@
+package ledger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CategoryTaxonomy selects which of plaid's category schemes is used for the
+// Category column, reports and budgets
+type CategoryTaxonomy string
+
+const (
+	CategoryLegacy          CategoryTaxonomy = "legacy" // hierarchical category, e.g. Food and Drink.Restaurants
+	CategoryPersonalFinance CategoryTaxonomy = "pfc"    // personal_finance_category, e.g. FOOD_AND_DRINK.RESTAURANT
+
+	DefaultCategoryTaxonomy = CategoryLegacy
+)
+
+func ParseCategoryTaxonomy(taxonomy string) (CategoryTaxonomy, error) {
+	switch t := CategoryTaxonomy(taxonomy); t {
+	case CategoryLegacy, CategoryPersonalFinance:
+		return t, nil
+	case "":
+		return DefaultCategoryTaxonomy, nil
+	default:
+		return "", fmt.Errorf("unknown category taxonomy: %q", taxonomy)
+	}
+}
+
+// Categories returns the transaction's category hierarchy in the given
+// taxonomy. Personal finance categories are returned as the primary
+// category followed by the detailed category without its primary prefix.
+func (t Transaction) Categories(taxonomy CategoryTaxonomy) []string {
+	if taxonomy != CategoryPersonalFinance {
+		return t.Category
+	}
+
+	pfc := t.PersonalFinanceCategory
+	if pfc.Primary == "" {
+		return nil
+	}
+	detailed := strings.TrimPrefix(pfc.Detailed, pfc.Primary+"_")
+	if detailed == "" || detailed == pfc.Primary {
+		return []string{pfc.Primary}
+	}
+	return []string{pfc.Primary, detailed}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/subtlepseudonym/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+func accountsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "accounts",
+		Short:        "List accounts for each item and add missing accounts to the config",
+		Args:         cobra.NoArgs,
+		RunE:         listAccounts,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.Bool("write", false, "Add unmapped accounts to the config file, named after the account")
+	flags.Bool("interactive", false, "Prompt for a name for each unmapped account and add it to the config file")
+
+	return cmd
+}
+
+func listAccounts(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	environment, _ := flags.GetString("environment")
+	if !confirmEnvironment(cmd, environment) {
+		return nil
+	}
+
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	config, err := ledger.LoadConfig(configPath, environment)
+	if err != nil {
+		return fmt.Errorf("load config from file: %w", err)
+	}
+
+	accounts, err := ledger.RequestAccounts(config)
+	if err != nil {
+		return fmt.Errorf("request accounts from plaid: %w", err)
+	}
+
+	itemIDs := make([]string, 0, len(accounts))
+	for itemID := range accounts {
+		itemIDs = append(itemIDs, itemID)
+	}
+	sort.Strings(itemIDs)
+
+	var unmapped []ledger.AccountMapping
+	unmappedAccounts := make(map[string]ledger.Account)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ITEM\tACCOUNT ID\tMASK\tNAME\tOFFICIAL NAME\tTYPE\tSUBTYPE\tMAPPED")
+	for _, itemID := range itemIDs {
+		itemConfig := config.Items[itemID]
+		for _, account := range accounts[itemID] {
+			investment := ledger.IsInvestmentAccount(account)
+			mapped, ok := itemConfig.Transactions[account.ID]
+			if investment {
+				mapped, ok = itemConfig.Investments[account.ID]
+			}
+			if !ok {
+				mapped = "-"
+				unmapped = append(unmapped, ledger.AccountMapping{
+					ItemID:     itemID,
+					AccountID:  account.ID,
+					Name:       account.Name,
+					Investment: investment,
+				})
+				unmappedAccounts[account.ID] = account
+			}
+
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				itemConfig.Name,
+				account.ID,
+				account.Mask,
+				account.Name,
+				account.OfficialName,
+				account.Type,
+				account.Subtype,
+				mapped,
+			)
+		}
+	}
+	w.Flush()
+
+	write, _ := flags.GetBool("write")
+	interactive, _ := flags.GetBool("interactive")
+	if len(unmapped) == 0 || !(write || interactive) {
+		return nil
+	}
+
+	if interactive {
+		var mappings []ledger.AccountMapping
+		scanner := bufio.NewScanner(os.Stdin)
+		for _, mapping := range unmapped {
+			account := unmappedAccounts[mapping.AccountID]
+			kind := "transactions"
+			if mapping.Investment {
+				kind = "investments"
+			}
+
+			fmt.Printf("Name for %s account %q (%s) in %q, blank to skip: ", kind, account.Name, account.Mask, config.Items[mapping.ItemID].Name)
+			if !scanner.Scan() {
+				break
+			}
+			name := strings.TrimSpace(scanner.Text())
+			if name == "" {
+				continue
+			}
+			mapping.Name = name
+			mappings = append(mappings, mapping)
+		}
+		unmapped = mappings
+	}
+
+	if len(unmapped) == 0 {
+		return nil
+	}
+
+	data, encrypted, err := ledger.ReadConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	data, err = ledger.AddAccountMappings(data, environment, unmapped)
+	if err != nil {
+		return fmt.Errorf("add account mappings: %w", err)
+	}
+
+	err = ledger.WriteConfigFile(configPath, data, encrypted)
+	if err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+	fmt.Printf("Added %d accounts to %s\n", len(unmapped), configPath)
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subtlepseudonym/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+func budgetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "budget",
+		Short:        "Compare spending against configured budgets for the current period",
+		Args:         cobra.NoArgs,
+		RunE:         budgetReport,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	addTransactionSourceFlags(flags)
+	flags.String("as-of", "", "Date to report budgets as of; defaults to today. Format: YYYY-MM-DD")
+	flags.String("output-format", outputFormatTable, "Report output format (table|csv|json)")
+
+	return cmd
+}
+
+func budgetReport(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	outputFormat, _ := flags.GetString("output-format")
+	switch outputFormat {
+	case outputFormatTable, outputFormatCSV, outputFormatJSON:
+	default:
+		return fmt.Errorf("unknown output format: %q", outputFormat)
+	}
+
+	config, err := readEnvironmentConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if len(config.Budgets) == 0 {
+		return fmt.Errorf("no budgets configured for environment %q", config.Environment)
+	}
+	for i, budget := range config.Budgets {
+		if err := budget.Validate(); err != nil {
+			return fmt.Errorf("budget %d: %w", i, err)
+		}
+	}
+
+	location, err := getLocation(cmd, config)
+	if err != nil {
+		return fmt.Errorf("load time zone: %w", err)
+	}
+
+	now := time.Now().In(location)
+	asOf := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if asOfDate, _ := flags.GetString("as-of"); asOfDate != "" {
+		asOf, err = time.ParseInLocation(time.DateOnly, asOfDate, location)
+		if err != nil {
+			return fmt.Errorf("parse as-of date: %w", err)
+		}
+	}
+
+	start := asOf
+	for _, budget := range config.Budgets {
+		periodStart, _ := budget.PeriodBounds(asOf)
+		if periodStart.Before(start) {
+			start = periodStart
+		}
+	}
+
+	transactions, err := loadTransactions(cmd, location, start, asOf)
+	if err != nil {
+		return fmt.Errorf("load transactions: %w", err)
+	}
+
+	delimiter, _ := flags.GetString("category-delimiter")
+	statuses := ledger.NewBudgetReport(config.Budgets, transactions, delimiter, asOf)
+
+	switch outputFormat {
+	case outputFormatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(statuses)
+		if err != nil {
+			return fmt.Errorf("encode report: %w", err)
+		}
+	case outputFormatCSV:
+		output := csv.NewWriter(os.Stdout)
+		output.Write([]string{"Category", "Account", "Period", "Start", "Budget", "Actual", "Remaining", "Projected", "Overspend"})
+		for _, status := range statuses {
+			output.Write(budgetRow(status))
+		}
+		output.Flush()
+		if err = output.Error(); err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "Category\tAccount\tPeriod\tStart\tBudget\tActual\tRemaining\tProjected\tOverspend\t")
+		for _, status := range statuses {
+			for _, field := range budgetRow(status) {
+				fmt.Fprintf(w, "%s\t", field)
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	}
+
+	return nil
+}
+
+func budgetRow(status ledger.BudgetStatus) []string {
+	return []string{
+		status.Category,
+		status.Account,
+		string(status.Period),
+		status.Start.Format(time.DateOnly),
+		fmt.Sprintf(ledger.DefaultAmountFormat, status.Amount),
+		fmt.Sprintf(ledger.DefaultAmountFormat, status.Actual),
+		fmt.Sprintf(ledger.DefaultAmountFormat, status.Remaining),
+		fmt.Sprintf(ledger.DefaultAmountFormat, status.Projected),
+		fmt.Sprintf(ledger.DefaultAmountFormat, status.Overspend),
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/subtlepseudonym/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultEditor = "vi"
+
+func configCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the config file",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "edit",
+		Short:        "Edit the config file with $EDITOR, decrypting and re-encrypting it if necessary",
+		Args:         cobra.NoArgs,
+		RunE:         editConfig,
+		SilenceUsage: true,
+	})
+	validate := &cobra.Command{
+		Use:          "validate",
+		Short:        "Check the config file for problems",
+		Args:         cobra.NoArgs,
+		RunE:         validateConfig,
+		SilenceUsage: true,
+	}
+	validate.Flags().Bool("live", false, "Verify tokens and account IDs against plaid for the selected environment")
+	validate.Flags().String("base-url", "", "Plaid API URL to verify against, e.g. a fake server")
+	cmd.AddCommand(validate)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "encrypt",
+		Short:        "Encrypt the config file with a passphrase",
+		Args:         cobra.NoArgs,
+		RunE:         encryptConfig,
+		SilenceUsage: true,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:          "decrypt",
+		Short:        "Decrypt the config file in place",
+		Args:         cobra.NoArgs,
+		RunE:         decryptConfig,
+		SilenceUsage: true,
+	})
+
+	return cmd
+}
+
+func editConfig(cmd *cobra.Command, args []string) error {
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	data, encrypted, err := ledger.ReadConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp("", "ledger-config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("write temp file: %w", err)
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = defaultEditor
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		editCmd := exec.Command("sh", "-c", fmt.Sprintf("%s %q", editor, tmp.Name()))
+		editCmd.Stdin = os.Stdin
+		editCmd.Stdout = os.Stdout
+		editCmd.Stderr = os.Stderr
+		err = editCmd.Run()
+		if err != nil {
+			return fmt.Errorf("run editor: %w", err)
+		}
+
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return fmt.Errorf("read temp file: %w", err)
+		}
+
+		if bytes.Equal(edited, data) {
+			fmt.Println("No changes made")
+			return nil
+		}
+
+		problems := ledger.ValidateConfig(edited)
+		if len(problems) == 0 {
+			data = edited
+			break
+		}
+
+		fmt.Println("Invalid config:")
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		fmt.Println("Enter 'yes' to edit again, anything else discards changes")
+		if scanner.Scan(); strings.TrimSpace(scanner.Text()) != "yes" {
+			return fmt.Errorf("config has %d problems", len(problems))
+		}
+	}
+
+	err = ledger.WriteConfigFile(configPath, data, encrypted)
+	if err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+
+	return nil
+}
+
+func validateConfig(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	data, _, err := ledger.ReadConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	problems := ledger.ValidateConfig(data)
+
+	live, _ := flags.GetBool("live")
+	if live && len(problems) == 0 {
+		environment, _ := flags.GetString("environment")
+		if !confirmEnvironment(cmd, environment) {
+			return nil
+		}
+
+		config, err := ledger.LoadConfig(configPath, environment)
+		if err != nil {
+			return fmt.Errorf("load config from file: %w", err)
+		}
+
+		baseURL, _ := flags.GetString("base-url")
+		if baseURL != "" {
+			config.BaseURL = baseURL
+		}
+
+		problems = append(problems, ledger.VerifyConfig(config)...)
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("config has %d problems", len(problems))
+	}
+
+	fmt.Printf("%s is valid\n", configPath)
+	return nil
+}
+
+func encryptConfig(cmd *cobra.Command, args []string) error {
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	data, encrypted, err := ledger.ReadConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if encrypted {
+		return fmt.Errorf("config file is already encrypted")
+	}
+
+	_, err = ledger.ParseConfig(data)
+	if err != nil {
+		return fmt.Errorf("validate config: %w", err)
+	}
+
+	err = ledger.WriteConfigFile(configPath, data, true)
+	if err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+
+	return nil
+}
+
+func decryptConfig(cmd *cobra.Command, args []string) error {
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	data, encrypted, err := ledger.ReadConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if !encrypted {
+		return fmt.Errorf("config file is not encrypted")
+	}
+
+	err = ledger.WriteConfigFile(configPath, data, false)
+	if err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+
+	return nil
+}
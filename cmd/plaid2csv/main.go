@@ -2,11 +2,13 @@ package main
 
 import (
 	"bufio"
-	"encoding/csv"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
-	"sort"
 	"strings"
 	"time"
 
@@ -38,30 +40,31 @@ func main() {
 		SilenceUsage: true,
 	}
 
+	persistentFlags := cmd.PersistentFlags()
+	persistentFlags.String("environment", defaultEnvironment, "Environment to run in (sandbox|development|production)")
+	persistentFlags.String("config", defaultConfigPath, "Config file path")
+	persistentFlags.Bool("yes", false, "Assume yes to prompts; run non-interactively")
+	persistentFlags.String("time-zone", "", "IANA time zone for dates, e.g. America/New_York; defaults to the configured time zone or UTC")
+
 	flags := cmd.Flags()
-	flags.String("start", "", "Start date, inclusive. Format: YYYY-MM-DD")
-	flags.String("end", "", "End date, inclusive. Format: YYYY-MM-DD")
-
-	flags.String("environment", defaultEnvironment, "Environment to run in (sandbox|development|production)")
-	flags.String("config", defaultConfigPath, "Config file path")
-	flags.String("output-transactions", "transactions.csv", "Path for transactions output file")
-	flags.String("output-investments", "investments.csv", "Path for investments output file")
-
-	flags.Bool("clamp-semimonthly", false, "Remove transactions outside semimonthly period")
-	flags.Bool("inclusive-end-date", false, "Include transactions on the end date")
-	flags.Bool("sort", false, "Sort transactions by date for each account")
-	flags.Bool("omit-header", false, "Omit csv header")
-	flags.Bool("omit-pending", false, "Omit pending transactions")
-	flags.Bool("yes", false, "Assume yes to prompts; run non-interactively")
+	addWindowFlags(flags)
 	flags.Duration("refresh-threshold", ledger.RefreshThresholdLimit, "WARN: ($0.12/item) Request refresh if older than duration")
-	flags.String("category-delimiter", ledger.DefaultCategoryDelimiter, "Delimiter for joining category hierarchy")
-	flags.String("format-post-date", ledger.DefaultPostDateFormat, "Output format for transaction post date")
-	flags.String("format-auth-date", ledger.DefaultAuthDateFormat, "Output format for transaction authorization date")
-	flags.String("format-amount", ledger.DefaultAmountFormat, "Output format for amount")
-	flags.String("format-commodity-price", ledger.DefaultCommodityPriceFormat, "Output format for commodity price")
-
-	cmd.MarkFlagRequired("start")
-	cmd.MarkFlagRequired("end")
+	flags.String("archive", "", "Directory to save raw plaid responses to, in a subdirectory named for the fetch time; disabled if empty")
+	flags.String("lot-history-start", "", "Date in YYYY-MM-DD format to request earlier investment activity from, so that sales of shares bought before the start date have a cost basis")
+	addOutputFlags(flags)
+
+	cmd.MarkFlagsRequiredTogether("start", "end")
+	cmd.MarkFlagsMutuallyExclusive("period", "start")
+	cmd.MarkFlagsMutuallyExclusive("period", "end")
+	cmd.MarkFlagsMutuallyExclusive("period", "clamp-semimonthly")
+
+	cmd.AddCommand(configCommand())
+	cmd.AddCommand(accountsCommand())
+	cmd.AddCommand(statusCommand())
+	cmd.AddCommand(reportCommand())
+	cmd.AddCommand(budgetCommand())
+	cmd.AddCommand(renderCommand())
+	cmd.AddCommand(securitiesCommand())
 
 	err := cmd.Execute()
 	if err != nil {
@@ -72,199 +75,201 @@ func main() {
 func run(cmd *cobra.Command, args []string) error {
 	flags := cmd.Flags()
 
-	yes, _ := flags.GetBool("yes")
 	environment, _ := flags.GetString("environment")
-	if environment == "production" && !yes {
-		fmt.Println("This will run against the production environment and may incur charges. Enter 'yes' to continue")
-		scanner := bufio.NewScanner(os.Stdin)
-		if scanner.Scan(); scanner.Text() != "yes" {
-			return nil
-		}
+	if !confirmEnvironment(cmd, environment) {
+		return nil
 	}
 
-	startDate, _ := flags.GetString("start")
-	start, err := time.Parse(time.DateOnly, startDate)
+	configPath, err := getConfigPath(cmd)
 	if err != nil {
-		return fmt.Errorf("parse start date: %w", err)
+		return fmt.Errorf("get config path: %w", err)
 	}
 
-	endDate, _ := flags.GetString("end")
-	end, err := time.Parse(time.DateOnly, endDate)
+	config, err := ledger.LoadConfig(configPath, environment)
 	if err != nil {
-		return fmt.Errorf("parse end date: %w", err)
+		return fmt.Errorf("load config from file: %w", err)
 	}
 
-	inclusiveEndDate, _ := flags.GetBool("inclusive-end-date")
-	if inclusiveEndDate {
-		end = end.AddDate(0, 0, 1)
+	location, err := getLocation(cmd, config)
+	if err != nil {
+		return fmt.Errorf("load time zone: %w", err)
 	}
 
-	configPath, _ := flags.GetString("config")
-	if configPath == defaultConfigPath {
-		homePath, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("get user home directory: %w", err)
-		}
-		configPath = strings.Replace(configPath, "~", homePath, 1)
+	window, err := getWindow(cmd, config, time.Now().In(location), "", "")
+	if err != nil {
+		return err
 	}
 
-	config, err := ledger.LoadConfig(configPath, environment)
+	r, err := newRenderer(cmd, config, location, window)
 	if err != nil {
-		return fmt.Errorf("load config from file: %w", err)
+		return err
 	}
+	defer r.close()
 
-	transactionsOutputPath, _ := flags.GetString("output-transactions")
-	transactionsOutputFile, err := os.OpenFile(transactionsOutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("open transactions output file for writing: %w", err)
+	if archiveRoot, _ := flags.GetString("archive"); archiveRoot != "" {
+		config.Archive, err = ledger.NewArchive(archiveRoot, environment, window.FetchStart, window.FetchEnd)
+		if err != nil {
+			return fmt.Errorf("create archive: %w", err)
+		}
+		log.Printf("Archiving responses to %s\n", config.Archive.Dir)
 	}
-	defer transactionsOutputFile.Close()
 
-	investmentsOutputPath, _ := flags.GetString("output-investments")
-	investmentsOutputFile, err := os.OpenFile(investmentsOutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("open investments output file for writing: %w", err)
+	if historyStart, _ := flags.GetString("lot-history-start"); historyStart != "" && r.tracksLots() {
+		start, err := time.ParseInLocation(time.DateOnly, historyStart, location)
+		if err != nil {
+			return fmt.Errorf("parse lot history start: %w", err)
+		}
+		end := window.FetchStart.AddDate(0, 0, -1)
+		if start.After(end) {
+			return fmt.Errorf("lot history start %s is not before the start date", historyStart)
+		}
+
+		history, err := ledger.RequestInvestmentHistory(config, start, end)
+		if err != nil {
+			return fmt.Errorf("request investment history from plaid: %w", err)
+		}
+		r.addLotHistory(location, history)
 	}
-	defer investmentsOutputFile.Close()
 
 	refreshThreshold, _ := flags.GetDuration("refresh-threshold")
-	activity, err := ledger.RequestActivity(config, start, end, refreshThreshold)
+	activity, err := ledger.RequestActivity(config, window.FetchStart, window.FetchEnd, refreshThreshold, r.pricesOutputPath != "")
 	if err != nil {
 		return fmt.Errorf("request activity from plaid: %w", err)
 	}
-
-	omitHeader, _ := flags.GetBool("omit-header")
-	transactionsOutput := csv.NewWriter(transactionsOutputFile)
-	if !omitHeader {
-		headers := []string{
-			"Post Date",
-			"Authorized Date",
-			"Account",
-			"Account Name",
-			"Check Number",
-			"Payee",
-			"Amount",
-			"Currency",
-			"Category",
-			"Transaction ID",
-		}
-		transactionsOutput.Write(headers)
+	for _, item := range activity {
+		item.In(location)
 	}
 
-	investmentsOutput := csv.NewWriter(investmentsOutputFile)
-	if !omitHeader {
-		headers := []string{
-			"Post Date",
-			"Account",
-			"Account Name",
-			"Name",
-			"Quantity",
-			"Amount",
-			"Price",
-			"Transaction ID",
-			"Fee",
-			"Fee Currency",
-			"Ticker Symbol",
-			"Category",
+	return r.render(config, activity)
+}
+
+// confirmEnvironment prompts before running against production unless
+// prompts are disabled
+func confirmEnvironment(cmd *cobra.Command, environment string) bool {
+	yes, _ := cmd.Flags().GetBool("yes")
+	if environment == "production" && !yes {
+		fmt.Println("This will run against the production environment and may incur charges. Enter 'yes' to continue")
+		scanner := bufio.NewScanner(os.Stdin)
+		if scanner.Scan(); scanner.Text() != "yes" {
+			return false
 		}
-		investmentsOutput.Write(headers)
 	}
+	return true
+}
 
-	clampSemimonthly, _ := flags.GetBool("clamp-semimonthly")
-	sortOutput, _ := flags.GetBool("sort")
-	omitPending, _ := flags.GetBool("omit-pending")
-	postDateFormat, _ := flags.GetString("format-post-date")
-	authDateFormat, _ := flags.GetString("format-auth-date")
-	amountFormat, _ := flags.GetString("format-amount")
-	commodityPriceFormat, _ := flags.GetString("format-commodity-price")
-	categoryDelimiter, _ := flags.GetString("category-delimiter")
-
-	options := &ledger.WriteOptions{
-		OmitPending:          omitPending,
-		PostDateFormat:       postDateFormat,
-		AuthDateFormat:       authDateFormat,
-		AmountFormat:         amountFormat,
-		CommodityPriceFormat: commodityPriceFormat,
-		CategoryDelimiter:    categoryDelimiter,
+// outputDialect applies csv dialect flags to a configured dialect, flags
+// taking precedence when set
+func outputDialect(cmd *cobra.Command, dialect ledger.Dialect) ledger.Dialect {
+	flags := cmd.Flags()
+	if flags.Changed("csv-delimiter") || dialect.Delimiter == "" {
+		dialect.Delimiter, _ = flags.GetString("csv-delimiter")
 	}
+	if flags.Changed("csv-always-quote") {
+		dialect.AlwaysQuote, _ = flags.GetBool("csv-always-quote")
+	}
+	if flags.Changed("csv-crlf") {
+		dialect.CRLF, _ = flags.GetBool("csv-crlf")
+	}
+	if flags.Changed("csv-bom") {
+		dialect.BOM, _ = flags.GetBool("csv-bom")
+	}
+	if flags.Changed("decimal-separator") || dialect.DecimalSeparator == "" {
+		dialect.DecimalSeparator, _ = flags.GetString("decimal-separator")
+	}
+	return dialect
+}
 
-	var transactionsCount int
-	var investmentsCount int
-	for _, item := range activity {
-		itemConfig, ok := config.Items[item.ID]
-		if !ok {
-			log.Printf("Warning: skipping data for unknown item ID: %q\n", item.ID)
-			continue
+// newOutputWriter returns a writer for an output file, writing a byte order
+// mark first if the dialect calls for one and the file is empty
+func newOutputWriter(f *os.File, dialect ledger.Dialect) (ledger.RecordWriter, error) {
+	if dialect.BOM {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("stat output file: %w", err)
 		}
-
-		if clampSemimonthly {
-			clampEndDate := end
-			if end.Day() < 15 {
-				clampEndDate = time.Date(end.Year(), end.Month(), 1, 0, 0, 0, -1, end.Location())
-			} else {
-				clampEndDate = time.Date(end.Year(), end.Month(), 16, 0, 0, 0, -1, end.Location())
-			}
-
-			var transactions []ledger.Transaction
-			for _, transaction := range item.Transactions {
-				if transaction.AuthorizedDate.Time.IsZero() {
-					if transaction.Date.Time.After(clampEndDate) || start.After(transaction.Date.Time) {
-						continue
-					}
-				} else {
-					if transaction.AuthorizedDate.Time.After(clampEndDate) || start.After(transaction.AuthorizedDate.Time) {
-						continue
-					}
-				}
-				transactions = append(transactions, transaction)
+		if info.Size() == 0 {
+			if _, err = io.WriteString(f, ledger.ByteOrderMark); err != nil {
+				return nil, fmt.Errorf("write byte order mark: %w", err)
 			}
-			item.Transactions = transactions
-
-			var investments []ledger.InvestmentTransaction
-			for _, investment := range item.Investments {
-				if investment.Date.Time.After(clampEndDate) || start.After(investment.Date.Time) {
-					continue
-				}
-				investments = append(investments, investment)
-			}
-			item.Investments = investments
 		}
+	}
 
-		if sortOutput {
-			sort.Slice(item.Transactions, func(i, j int) bool {
-				return item.Transactions[j].Date.Time.After(item.Transactions[i].Date.Time)
-			})
-			sort.Slice(item.Investments, func(i, j int) bool {
-				return item.Investments[j].Date.Time.After(item.Investments[i].Date.Time)
-			})
-		}
+	return ledger.NewRecordWriter(f, dialect)
+}
 
-		err, txn := ledger.WriteTransactions(itemConfig, transactionsOutput, item, options)
-		if err != nil {
-			return fmt.Errorf("write transactions for %q to output: %w", itemConfig.Name, err)
-		}
-		transactionsCount += txn
+// getLocation returns the time zone given by flag, falling back to the
+// configured time zone if config is non-nil
+func getLocation(cmd *cobra.Command, config *ledger.Config) (*time.Location, error) {
+	timeZone, _ := cmd.Flags().GetString("time-zone")
+	if timeZone != "" {
+		return time.LoadLocation(timeZone)
+	}
+	if config != nil {
+		return config.Location()
+	}
+	return time.UTC, nil
+}
 
-		err, inv := ledger.WriteInvestments(itemConfig, investmentsOutput, item, options)
-		if err != nil {
-			return fmt.Errorf("write investments for %q to output: %w", itemConfig.Name, err)
-		}
-		investmentsCount += inv
+// getCategoryTaxonomy returns the category taxonomy given by flag, falling
+// back to the configured taxonomy if config is non-nil
+func getCategoryTaxonomy(cmd *cobra.Command, config *ledger.Config) (ledger.CategoryTaxonomy, error) {
+	taxonomy, _ := cmd.Flags().GetString("category-taxonomy")
+	if taxonomy == "" && config != nil {
+		taxonomy = string(config.CategoryTaxonomy)
 	}
+	return ledger.ParseCategoryTaxonomy(taxonomy)
+}
 
-	if transactionsCount == 0 {
-		transactionsOutputFile.Close()
-		err = os.Remove(transactionsOutputPath)
+func getConfigPath(cmd *cobra.Command) (string, error) {
+	configPath, _ := cmd.Flags().GetString("config")
+	if configPath == defaultConfigPath {
+		homePath, err := os.UserHomeDir()
 		if err != nil {
-			return fmt.Errorf("remove empty transactions output file: %w", err)
+			return "", fmt.Errorf("get user home directory: %w", err)
 		}
+		configPath = strings.Replace(configPath, "~", homePath, 1)
 	}
-	if investmentsCount == 0 {
-		investmentsOutputFile.Close()
-		err = os.Remove(investmentsOutputPath)
+
+	return configPath, nil
+}
+
+// updatePrices merges new prices into the price history file, creating it if
+// it doesn't exist. The merged history is written to a temporary file and
+// renamed over the original so that a failed write doesn't lose it.
+func updatePrices(path string, format ledger.PriceFormat, prices []ledger.Price, options *ledger.WriteOptions) error {
+	var existing []ledger.Price
+	mode := os.FileMode(0644)
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+
+		if info, err := f.Stat(); err == nil {
+			mode = info.Mode().Perm()
+		}
+		existing, err = ledger.ReadPrices(f, format, options.Dialect)
 		if err != nil {
-			return fmt.Errorf("remove empty investments output file: %w", err)
+			return fmt.Errorf("read prices file: %w", err)
 		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("open prices file: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = ledger.WritePrices(&buf, ledger.MergePrices(existing, prices), format, options)
+	if err != nil {
+		return fmt.Errorf("write prices: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, buf.Bytes(), mode)
+	if err != nil {
+		return fmt.Errorf("write prices file: %w", err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename prices file: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,754 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/subtlepseudonym/ledger"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	gainsHeader = []string{
+		"Sale Date",
+		"Acquired Date",
+		"Account",
+		"Account Name",
+		"Name",
+		"Ticker Symbol",
+		"Quantity",
+		"Proceeds",
+		"Cost Basis",
+		"Gain",
+		"Term",
+		"Sale Transaction ID",
+		"Lot Transaction ID",
+	}
+	taxHeader = []string{
+		"Description",
+		"Date Acquired",
+		"Date Sold",
+		"Proceeds",
+		"Cost Basis",
+		"Adjustment Code",
+		"Adjustment",
+		"Gain or Loss",
+		"Box",
+		"Account",
+		"Account Name",
+		"Sale Transaction ID",
+		"Note",
+	}
+)
+
+func renderCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "render",
+		Short:        "Write outputs from archived plaid responses without requesting new data",
+		Args:         cobra.NoArgs,
+		RunE:         renderArchive,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.String("archive", "", "Archive directory to render, as created with --archive")
+	addWindowFlags(flags)
+	addOutputFlags(flags)
+
+	cmd.MarkFlagRequired("archive")
+	cmd.MarkFlagsMutuallyExclusive("period", "start")
+	cmd.MarkFlagsMutuallyExclusive("period", "end")
+	cmd.MarkFlagsMutuallyExclusive("period", "clamp-semimonthly")
+
+	return cmd
+}
+
+// addWindowFlags adds flags selecting the dates to request and write
+func addWindowFlags(flags *pflag.FlagSet) {
+	flags.String("start", "", "Start date, inclusive. Format: YYYY-MM-DD")
+	flags.String("end", "", "End date, inclusive. Format: YYYY-MM-DD")
+	flags.Bool("inclusive-end-date", false, "Include transactions on the end date")
+	flags.Bool("clamp-semimonthly", false, "Remove transactions outside semimonthly period")
+	flags.String("period", "", "Named period to request and write, replacing start and end (last-month|this-month|last-semimonth|quarter|last-quarter|ytd|last-year|fiscal-year|last-fiscal-year)")
+	flags.Int("fiscal-year-start", 0, "Month number the fiscal year starts in; defaults to the configured month or January")
+	flags.Int("settlement-days", ledger.DefaultSettlementDays, "Days past the end of a period to request transactions authorized within it")
+}
+
+// getWindow returns the window given by the period flag relative to now, or
+// by the start and end flags, falling back to the given default dates
+func getWindow(cmd *cobra.Command, config *ledger.Config, now time.Time, defaultStart, defaultEnd string) (ledger.Window, error) {
+	flags := cmd.Flags()
+
+	if periodName, _ := flags.GetString("period"); periodName != "" {
+		period, err := ledger.ParsePeriod(periodName)
+		if err != nil {
+			return ledger.Window{}, fmt.Errorf("parse period: %w", err)
+		}
+
+		fiscalYearStart := config.FiscalYearStart
+		if flags.Changed("fiscal-year-start") {
+			month, _ := flags.GetInt("fiscal-year-start")
+			if month < 1 || month > 12 {
+				return ledger.Window{}, fmt.Errorf("fiscal year start must be a month number from 1 to 12")
+			}
+			fiscalYearStart = time.Month(month)
+		}
+		settlementDays, _ := flags.GetInt("settlement-days")
+
+		return period.Window(now, fiscalYearStart, settlementDays)
+	}
+
+	startDate, _ := flags.GetString("start")
+	if startDate == "" {
+		startDate = defaultStart
+	}
+	endDate, _ := flags.GetString("end")
+	if endDate == "" {
+		endDate = defaultEnd
+	}
+	if startDate == "" || endDate == "" {
+		return ledger.Window{}, fmt.Errorf("either period or start and end dates are required")
+	}
+
+	start, err := time.ParseInLocation(time.DateOnly, startDate, now.Location())
+	if err != nil {
+		return ledger.Window{}, fmt.Errorf("parse start date: %w", err)
+	}
+	end, err := time.ParseInLocation(time.DateOnly, endDate, now.Location())
+	if err != nil {
+		return ledger.Window{}, fmt.Errorf("parse end date: %w", err)
+	}
+
+	// default end dates, e.g. from an archive, already include the end date
+	// if requested
+	inclusiveEndDate, _ := flags.GetBool("inclusive-end-date")
+	if inclusiveEndDate && flags.Changed("end") {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	if clampSemimonthly, _ := flags.GetBool("clamp-semimonthly"); clampSemimonthly {
+		return ledger.SemimonthlyWindow(start, end), nil
+	}
+	return ledger.Window{FetchStart: start, FetchEnd: end}, nil
+}
+
+// addOutputFlags adds flags controlling how item data is written
+func addOutputFlags(flags *pflag.FlagSet) {
+	flags.String("output-transactions", "transactions.csv", "Path for transactions output file")
+	flags.String("output-investments", "investments.csv", "Path for investments output file")
+	flags.String("output-gains", "", "Path for realized gains output file; disabled if empty")
+	flags.String("output-8949", "", "Path for form 8949 capital gains output file; disabled if empty")
+	flags.String("output-prices", "", "Path for commodity price history file, updated in place; disabled if empty")
+	flags.String("output-geojson", "", "Path for GeoJSON map of transaction locations, overwritten; disabled if empty")
+	flags.String("output-journal", "", "Path for journal of transactions and investments, appended to; disabled if empty. Matched transfers are written as a single transaction")
+	flags.String("output-journal-format", string(ledger.DefaultJournalFormat), "Output format for the journal (ledger|beancount)")
+
+	flags.Bool("sort", false, "Sort transactions by date for each account")
+	flags.Bool("omit-header", false, "Omit csv header")
+	flags.Bool("omit-pending", false, "Omit pending transactions")
+	flags.String("category-delimiter", ledger.DefaultCategoryDelimiter, "Delimiter for joining category hierarchy")
+	flags.String("category-taxonomy", "", "Category taxonomy for the category column (legacy|pfc); defaults to the configured taxonomy or legacy")
+	flags.String("format-post-date", ledger.DefaultPostDateFormat, "Output format for transaction post date")
+	flags.String("format-auth-date", ledger.DefaultAuthDateFormat, "Output format for transaction authorization date")
+	flags.String("format-amount", ledger.DefaultAmountFormat, "Output format for amount")
+	flags.String("format-commodity-price", ledger.DefaultCommodityPriceFormat, "Output format for commodity price")
+	flags.String("format-datetime", ledger.DefaultDatetimeFormat, "Output format for transaction datetimes")
+	flags.Bool("option-columns", false, "Add option contract symbol, type, expiration, strike and underlying columns to investments output")
+	flags.Bool("datetime-columns", false, "Add transaction and authorization datetime columns to transactions output")
+	flags.Int("tax-year", 0, "Tax year for form 8949 output; defaults to the year of the start date")
+	flags.String("format-tax-date", ledger.DefaultTaxDateFormat, "Output format for form 8949 dates")
+	flags.String("price-format", string(ledger.DefaultPriceFormat), "Output format for commodity prices (ledger|beancount|csv)")
+	flags.String("unmapped", string(ledger.DefaultUnmappedPolicy), "Handling of unmapped accounts and securities (fail|skip|fallback)")
+	flags.String("fallback-account-format", ledger.DefaultFallbackAccountFormat, "Account name format for unmapped accounts, given the account mask")
+	flags.String("fallback-security-format", ledger.DefaultFallbackSecurityFormat, "Security name format for unknown securities, given the security ID")
+	flags.String("csv-delimiter", ledger.DefaultDelimiter, "Csv field delimiter; a single character or \"tab\"")
+	flags.Bool("csv-always-quote", false, "Quote every csv field")
+	flags.Bool("csv-crlf", false, "End csv lines with CRLF")
+	flags.Bool("csv-bom", false, "Write a UTF-8 byte order mark to new csv files")
+	flags.String("decimal-separator", ledger.DefaultDecimalSeparator, "Decimal separator for amounts, prices and quantities")
+	flags.StringSlice("payee-fields", nil, "Transaction fields to take the payee from, in order of preference (name|merchant_name|original_description|payment_meta.payee); defaults to the configured fields or name,merchant_name")
+	flags.StringSlice("payee-normalize", nil, "Normalization steps applied to payees, in order (strip-prefixes|trim-store-numbers|title-case); defaults to the configured steps")
+	flags.Bool("memo-column", false, "Add the original transaction description as a memo column to transactions output")
+	flags.Bool("match-transfers", false, "Match transfers between configured accounts, adding transfer columns to transactions output")
+	flags.Int("transfer-tolerance", ledger.DefaultTransferTolerance, "Maximum days between the two sides of a transfer")
+	flags.StringSlice("journal", nil, "Ledger or hledger journals whose transactions are omitted from output")
+	flags.String("journal-id-key", ledger.DefaultJournalIDKey, "Journal metadata key holding plaid transaction IDs")
+	flags.Int("journal-tolerance", ledger.DefaultJournalTolerance, "Maximum days between journal and plaid dates when matching journal entries without IDs")
+	flags.String("lot-method", string(ledger.DefaultLotMethod), "Lot selection method for realized gains (fifo|lifo|specific-id|average)")
+	flags.StringSlice("lot-archive", nil, "Archives of earlier activity to track lots from, so that sales of shares bought before the start date have a cost basis")
+}
+
+func renderArchive(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	archivePath, _ := flags.GetString("archive")
+	archive, err := ledger.OpenArchive(archivePath)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+
+	environment, _ := flags.GetString("environment")
+	if !flags.Changed("environment") {
+		environment = archive.Environment
+	} else if environment != archive.Environment {
+		return fmt.Errorf("archive was fetched from environment %q", archive.Environment)
+	}
+
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	config, err := ledger.LoadConfig(configPath, environment)
+	if err != nil {
+		return fmt.Errorf("load config from file: %w", err)
+	}
+
+	location, err := getLocation(cmd, config)
+	if err != nil {
+		return fmt.Errorf("load time zone: %w", err)
+	}
+
+	// periods are relative to when the archive was fetched
+	window, err := getWindow(cmd, config, archive.Fetched.In(location), archive.Start, archive.End)
+	if err != nil {
+		return err
+	}
+
+	r, err := newRenderer(cmd, config, location, window)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	activity, err := archive.Items()
+	if err != nil {
+		return fmt.Errorf("load archived activity: %w", err)
+	}
+	for _, item := range activity {
+		item.In(location)
+	}
+
+	return r.render(config, activity)
+}
+
+// output is a csv output file, removed after rendering if no records were
+// written to it
+type output struct {
+	name   string
+	path   string
+	file   *os.File
+	writer ledger.RecordWriter
+	count  int
+}
+
+func openOutput(name, path string, dialect ledger.Dialect, header []string, omitHeader bool) (*output, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open %s output file for writing: %w", name, err)
+	}
+
+	writer, err := newOutputWriter(f, dialect)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("create %s output writer: %w", name, err)
+	}
+	if !omitHeader {
+		writer.Write(header)
+	}
+
+	return &output{
+		name:   name,
+		path:   path,
+		file:   f,
+		writer: writer,
+	}, nil
+}
+
+func (o *output) removeIfEmpty() error {
+	if o == nil || o.count > 0 {
+		return nil
+	}
+
+	o.file.Close()
+	err := os.Remove(o.path)
+	if err != nil {
+		return fmt.Errorf("remove empty %s output file: %w", o.name, err)
+	}
+	return nil
+}
+
+// renderer writes item data to the outputs configured by flags
+type renderer struct {
+	window            ledger.Window
+	sortOutput        bool
+	matchTransfers    bool
+	transferTolerance int
+	journal           *ledger.JournalMatcher // nil if no journals given
+	lotMethod         ledger.LotMethod
+	lotHistory        []*ledger.ItemData // earlier investments to track lots from
+	taxYear           int
+	priceFormat       ledger.PriceFormat
+	pricesOutputPath  string
+	geoJSONOutputPath string
+	journalFormat     ledger.JournalFormat
+	journalOutputPath string
+
+	options             *ledger.WriteOptions
+	transactionsOptions *ledger.WriteOptions
+	investmentsOptions  *ledger.WriteOptions
+	gainsOptions        *ledger.WriteOptions
+	taxOptions          *ledger.WriteOptions
+	pricesOptions       *ledger.WriteOptions
+
+	transactions *output
+	investments  *output
+	gains        *output // nil if disabled
+	tax          *output // nil if disabled
+}
+
+// newRenderer parses output flags and opens output files, so that problems
+// with either are found before requesting data
+func newRenderer(cmd *cobra.Command, config *ledger.Config, location *time.Location, window ledger.Window) (*renderer, error) {
+	flags := cmd.Flags()
+
+	r := &renderer{
+		window: window,
+	}
+
+	r.taxYear, _ = flags.GetInt("tax-year")
+	if r.taxYear == 0 {
+		r.taxYear = window.FetchStart.Year()
+	}
+
+	var err error
+	r.pricesOutputPath, _ = flags.GetString("output-prices")
+	r.geoJSONOutputPath, _ = flags.GetString("output-geojson")
+	r.journalOutputPath, _ = flags.GetString("output-journal")
+	journalFormatName, _ := flags.GetString("output-journal-format")
+	r.journalFormat, err = ledger.ParseJournalFormat(journalFormatName)
+	if err != nil {
+		return nil, fmt.Errorf("parse journal format: %w", err)
+	}
+	priceFormatName, _ := flags.GetString("price-format")
+	r.priceFormat, err = ledger.ParsePriceFormat(priceFormatName)
+	if err != nil {
+		return nil, fmt.Errorf("parse price format: %w", err)
+	}
+
+	lotMethodName, _ := flags.GetString("lot-method")
+	r.lotMethod, err = ledger.ParseLotMethod(lotMethodName)
+	if err != nil {
+		return nil, fmt.Errorf("parse lot method: %w", err)
+	}
+
+	lotArchivePaths, _ := flags.GetStringSlice("lot-archive")
+	for _, lotArchivePath := range lotArchivePaths {
+		archive, err := ledger.OpenArchive(lotArchivePath)
+		if err != nil {
+			return nil, fmt.Errorf("open lot archive: %w", err)
+		}
+		if archive.Environment != config.Environment {
+			return nil, fmt.Errorf("lot archive %q was fetched from environment %q", lotArchivePath, archive.Environment)
+		}
+
+		history, err := archive.Items()
+		if err != nil {
+			return nil, fmt.Errorf("load lot archive %q: %w", lotArchivePath, err)
+		}
+		r.addLotHistory(location, history)
+	}
+
+	r.sortOutput, _ = flags.GetBool("sort")
+	omitPending, _ := flags.GetBool("omit-pending")
+	postDateFormat, _ := flags.GetString("format-post-date")
+	authDateFormat, _ := flags.GetString("format-auth-date")
+	amountFormat, _ := flags.GetString("format-amount")
+	commodityPriceFormat, _ := flags.GetString("format-commodity-price")
+	datetimeFormat, _ := flags.GetString("format-datetime")
+	categoryDelimiter, _ := flags.GetString("category-delimiter")
+	taxDateFormat, _ := flags.GetString("format-tax-date")
+	fallbackAccountFormat, _ := flags.GetString("fallback-account-format")
+	fallbackSecurityFormat, _ := flags.GetString("fallback-security-format")
+	journalIDKey, _ := flags.GetString("journal-id-key")
+
+	unmappedPolicyName, _ := flags.GetString("unmapped")
+	unmappedPolicy, err := ledger.ParseUnmappedPolicy(unmappedPolicyName)
+	if err != nil {
+		return nil, fmt.Errorf("parse unmapped policy: %w", err)
+	}
+
+	categoryTaxonomy, err := getCategoryTaxonomy(cmd, config)
+	if err != nil {
+		return nil, fmt.Errorf("parse category taxonomy: %w", err)
+	}
+
+	r.options = &ledger.WriteOptions{
+		Dialect:              ledger.NewDialect(),
+		OmitPending:          omitPending,
+		PostDateFormat:       postDateFormat,
+		AuthDateFormat:       authDateFormat,
+		AmountFormat:         amountFormat,
+		CommodityPriceFormat: commodityPriceFormat,
+		CategoryDelimiter:    categoryDelimiter,
+		CategoryTaxonomy:     categoryTaxonomy,
+		TaxDateFormat:        taxDateFormat,
+		DatetimeFormat:       datetimeFormat,
+		Location:             location,
+
+		UnmappedPolicy:         unmappedPolicy,
+		FallbackAccountFormat:  fallbackAccountFormat,
+		FallbackSecurityFormat: fallbackSecurityFormat,
+		Unmapped:               ledger.NewUnmappedLog(),
+
+		JournalIDKey: journalIDKey,
+	}
+
+	payeeConfig := config.Payee
+	if flags.Changed("payee-fields") {
+		fields, _ := flags.GetStringSlice("payee-fields")
+		payeeConfig.Fields = nil
+		for _, field := range fields {
+			payeeConfig.Fields = append(payeeConfig.Fields, ledger.PayeeField(field))
+		}
+	}
+	if flags.Changed("payee-normalize") {
+		normalizers, _ := flags.GetStringSlice("payee-normalize")
+		payeeConfig.Normalize = nil
+		for _, normalizer := range normalizers {
+			payeeConfig.Normalize = append(payeeConfig.Normalize, ledger.PayeeNormalizer(normalizer))
+		}
+	}
+	r.options.Payee, err = ledger.NewPayee(payeeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("parse payee config: %w", err)
+	}
+
+	// each output is written with its own dialect, so copy the options
+	dialectOptions := func(dialect *ledger.Dialect) *ledger.WriteOptions {
+		o := *r.options
+		o.Dialect = outputDialect(cmd, config.CSV.Output(dialect))
+		return &o
+	}
+	r.transactionsOptions = dialectOptions(config.CSV.Transactions)
+	r.investmentsOptions = dialectOptions(config.CSV.Investments)
+	r.gainsOptions = dialectOptions(config.CSV.Gains)
+	r.taxOptions = dialectOptions(config.CSV.Form8949)
+	r.pricesOptions = dialectOptions(config.CSV.Prices)
+
+	transactionColumns := ledger.DefaultTransactionColumns
+	if len(config.Columns.Transactions) > 0 {
+		transactionColumns = config.Columns.Transactions
+	}
+	if datetimeColumns, _ := flags.GetBool("datetime-columns"); datetimeColumns {
+		transactionColumns = append(append([]ledger.ColumnConfig{}, transactionColumns...), ledger.TransactionDatetimeColumns...)
+	}
+	if memoColumn, _ := flags.GetBool("memo-column"); memoColumn {
+		transactionColumns = append(append([]ledger.ColumnConfig{}, transactionColumns...), ledger.MemoColumns...)
+	}
+	r.matchTransfers, _ = flags.GetBool("match-transfers")
+	r.transferTolerance, _ = flags.GetInt("transfer-tolerance")
+	if r.matchTransfers {
+		transactionColumns = append(append([]ledger.ColumnConfig{}, transactionColumns...), ledger.TransferColumns...)
+	}
+	r.transactionsOptions.TransactionColumns, err = ledger.NewColumns(transactionColumns, r.transactionsOptions)
+	if err != nil {
+		return nil, fmt.Errorf("compile transactions columns: %w", err)
+	}
+
+	investmentColumns := ledger.DefaultInvestmentColumns
+	if len(config.Columns.Investments) > 0 {
+		investmentColumns = config.Columns.Investments
+	}
+	if optionColumns, _ := flags.GetBool("option-columns"); optionColumns {
+		investmentColumns = append(append([]ledger.ColumnConfig{}, investmentColumns...), ledger.OptionColumns...)
+	}
+	r.investmentsOptions.InvestmentColumns, err = ledger.NewColumns(investmentColumns, r.investmentsOptions)
+	if err != nil {
+		return nil, fmt.Errorf("compile investments columns: %w", err)
+	}
+
+	if journalPaths, _ := flags.GetStringSlice("journal"); len(journalPaths) > 0 {
+		var entries []ledger.JournalEntry
+		for _, journalPath := range journalPaths {
+			f, err := os.Open(journalPath)
+			if err != nil {
+				return nil, fmt.Errorf("open journal: %w", err)
+			}
+			read, err := ledger.ReadJournal(f, outputDialect(cmd, config.CSV.Dialect))
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read journal %q: %w", journalPath, err)
+			}
+			entries = append(entries, read...)
+		}
+
+		idKey, _ := flags.GetString("journal-id-key")
+		tolerance, _ := flags.GetInt("journal-tolerance")
+		r.journal = ledger.NewJournalMatcher(entries, idKey, tolerance)
+	}
+
+	omitHeader, _ := flags.GetBool("omit-header")
+
+	transactionsOutputPath, _ := flags.GetString("output-transactions")
+	r.transactions, err = openOutput("transactions", transactionsOutputPath, r.transactionsOptions.Dialect, r.transactionsOptions.TransactionColumns.Header(), omitHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	investmentsOutputPath, _ := flags.GetString("output-investments")
+	r.investments, err = openOutput("investments", investmentsOutputPath, r.investmentsOptions.Dialect, r.investmentsOptions.InvestmentColumns.Header(), omitHeader)
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+
+	if gainsOutputPath, _ := flags.GetString("output-gains"); gainsOutputPath != "" {
+		r.gains, err = openOutput("gains", gainsOutputPath, r.gainsOptions.Dialect, gainsHeader, omitHeader)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+
+	if taxOutputPath, _ := flags.GetString("output-8949"); taxOutputPath != "" {
+		r.tax, err = openOutput("form 8949", taxOutputPath, r.taxOptions.Dialect, taxHeader, omitHeader)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// tracksLots reports whether any output needs lots tracked
+func (r *renderer) tracksLots() bool {
+	return r.gains != nil || r.tax != nil
+}
+
+// addLotHistory adds earlier investment history to track lots from
+func (r *renderer) addLotHistory(location *time.Location, history []*ledger.ItemData) {
+	for _, item := range history {
+		item.In(location)
+	}
+	r.lotHistory = append(r.lotHistory, history...)
+}
+
+func (r *renderer) close() {
+	for _, o := range []*output{r.transactions, r.investments, r.gains, r.tax} {
+		if o != nil {
+			o.file.Close()
+		}
+	}
+}
+
+// renderItem is an item's data prepared for writing
+type renderItem struct {
+	config  *ledger.ItemConfig
+	data    *ledger.ItemData
+	gains   []ledger.RealizedGain
+	entries []ledger.Form8949Entry
+}
+
+func (r *renderer) render(config *ledger.Config, activity []*ledger.ItemData) error {
+	if r.matchTransfers {
+		transfers := ledger.MatchTransfers(config, activity, r.transferTolerance)
+		r.transactionsOptions.Transfers = ledger.TransfersByTransaction(transfers)
+		log.Printf("Matched %d transfers\n", len(transfers))
+	}
+
+	var err error
+	var journalCount, missingBasisCount int
+	var prices []ledger.Price
+	var features []ledger.GeoJSONFeature
+	var journalEntries []ledger.JournalEntry
+	var items []renderItem
+	for _, item := range activity {
+		itemConfig, ok := config.Items[item.ID]
+		if !ok {
+			log.Printf("Warning: skipping data for unknown item ID: %q\n", item.ID)
+			continue
+		}
+
+		config.MapSecurities(item)
+		prices = append(prices, ledger.CollectPrices(item)...)
+
+		var gains []ledger.RealizedGain
+		var entries []ledger.Form8949Entry
+		if r.tracksLots() {
+			lotItem := item.WithHistory(r.lotHistory)
+			gains, err = ledger.TrackLots(itemConfig, lotItem, r.lotMethod)
+			if err != nil {
+				return fmt.Errorf("track lots for %q: %w", itemConfig.Name, err)
+			}
+
+			gains = r.window.ClampGains(gains)
+			entries = ledger.Form8949(itemConfig, gains, r.taxYear)
+			for _, gain := range gains {
+				if gain.MissingBasis {
+					missingBasisCount += 1
+				}
+			}
+		}
+
+		r.window.Clamp(item)
+
+		if r.journal != nil {
+			journalCount += r.journal.Filter(itemConfig, item)
+		}
+
+		if r.sortOutput {
+			sort.Slice(item.Transactions, func(i, j int) bool {
+				return item.Transactions[j].Date.Time.After(item.Transactions[i].Date.Time)
+			})
+			sort.Slice(item.Investments, func(i, j int) bool {
+				return item.Investments[j].Date.Time.After(item.Investments[i].Date.Time)
+			})
+		}
+
+		if r.geoJSONOutputPath != "" {
+			features = append(features, ledger.TransactionFeatures(itemConfig, item, r.transactionsOptions)...)
+		}
+
+		// fail on unmapped records before writing any output
+		err = ledger.CheckUnmapped(itemConfig, item, gains, r.options)
+		if err != nil {
+			return fmt.Errorf("check %q for unmapped records: %w", itemConfig.Name, err)
+		}
+
+		items = append(items, renderItem{itemConfig, item, gains, entries})
+	}
+
+	for _, rendered := range items {
+		itemConfig, item := rendered.config, rendered.data
+
+		if r.journalOutputPath != "" {
+			transactionEntries, err := ledger.TransactionEntries(itemConfig, item, r.transactionsOptions)
+			if err != nil {
+				return fmt.Errorf("build journal entries for %q: %w", itemConfig.Name, err)
+			}
+			investmentEntries, err := ledger.InvestmentEntries(itemConfig, item, r.investmentsOptions)
+			if err != nil {
+				return fmt.Errorf("build journal entries for %q: %w", itemConfig.Name, err)
+			}
+			journalEntries = append(append(journalEntries, transactionEntries...), investmentEntries...)
+		}
+
+		err, txn := ledger.WriteTransactions(itemConfig, r.transactions.writer, item, r.transactionsOptions)
+		if err != nil {
+			return fmt.Errorf("write transactions for %q to output: %w", itemConfig.Name, err)
+		}
+		r.transactions.count += txn
+
+		err, inv := ledger.WriteInvestments(itemConfig, r.investments.writer, item, r.investmentsOptions)
+		if err != nil {
+			return fmt.Errorf("write investments for %q to output: %w", itemConfig.Name, err)
+		}
+		r.investments.count += inv
+
+		if r.gains != nil {
+			err, gns := ledger.WriteRealizedGains(itemConfig, r.gains.writer, item, rendered.gains, r.gainsOptions)
+			if err != nil {
+				return fmt.Errorf("write realized gains for %q to output: %w", itemConfig.Name, err)
+			}
+			r.gains.count += gns
+		}
+
+		if r.tax != nil {
+			err, tax := ledger.WriteForm8949(itemConfig, r.tax.writer, item, rendered.entries, r.taxOptions)
+			if err != nil {
+				return fmt.Errorf("write form 8949 entries for %q to output: %w", itemConfig.Name, err)
+			}
+			r.tax.count += tax
+		}
+	}
+
+	if r.journal != nil {
+		log.Printf("Omitted %d records already in journal\n", journalCount)
+	}
+	if missingBasisCount > 0 {
+		flagged := ""
+		if r.tax != nil {
+			flagged = ", flagged for manual entry in form 8949 entries"
+		}
+		log.Printf("Warning: %d sales matched no lot and have an unknown cost basis%s; track lots from earlier activity with --lot-archive or --lot-history-start\n", missingBasisCount, flagged)
+	}
+
+	for _, record := range r.options.Unmapped.Records() {
+		if record.RoutedTo == "" {
+			log.Printf("Warning: %s: skipped %d records for unmapped %s %q\n", record.Item, record.Count, record.Kind, record.ID)
+		} else {
+			log.Printf("Warning: %s: routed %d records for unmapped %s %q to %q\n", record.Item, record.Count, record.Kind, record.ID, record.RoutedTo)
+		}
+	}
+
+	if r.pricesOutputPath != "" {
+		err = updatePrices(r.pricesOutputPath, r.priceFormat, prices, r.pricesOptions)
+		if err != nil {
+			return fmt.Errorf("update prices: %w", err)
+		}
+	}
+
+	if r.journalOutputPath != "" {
+		journalEntries = ledger.MergeTransferEntries(journalEntries)
+		err = writeJournal(r.journalOutputPath, r.journalFormat, journalEntries, r.transactionsOptions)
+		if err != nil {
+			return fmt.Errorf("write journal: %w", err)
+		}
+		log.Printf("Wrote %d journal entries\n", len(journalEntries))
+	}
+
+	if r.geoJSONOutputPath != "" {
+		err = writeGeoJSON(r.geoJSONOutputPath, features)
+		if err != nil {
+			return fmt.Errorf("write geojson: %w", err)
+		}
+		log.Printf("Mapped %d transaction locations\n", len(features))
+	}
+
+	for _, o := range []*output{r.transactions, r.investments, r.gains, r.tax} {
+		if err = o.removeIfEmpty(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeJournal appends entries to the journal, which is left alone if there
+// are none
+func writeJournal(path string, format ledger.JournalFormat, entries []ledger.JournalEntry, options *ledger.WriteOptions) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open journal file: %w", err)
+	}
+	defer f.Close()
+
+	if err = ledger.WriteJournal(f, entries, format, options); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeGeoJSON(path string, features []ledger.GeoJSONFeature) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create geojson file: %w", err)
+	}
+	defer f.Close()
+
+	if err = ledger.WriteGeoJSON(f, features); err != nil {
+		return err
+	}
+	return f.Close()
+}
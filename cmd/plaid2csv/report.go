@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subtlepseudonym/ledger"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	outputFormatTable = "table"
+	outputFormatCSV   = "csv"
+	outputFormatJSON  = "json"
+)
+
+func reportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "report",
+		Short:        "Summarize spending by category and month",
+		Args:         cobra.NoArgs,
+		RunE:         spendingReport,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	addTransactionSourceFlags(flags)
+	flags.String("start", "", "Start date, inclusive. Format: YYYY-MM-DD")
+	flags.String("end", "", "End date, inclusive. Format: YYYY-MM-DD")
+	flags.Int("depth", 0, "Depth of category hierarchy to report; all levels if zero")
+	flags.String("output-format", outputFormatTable, "Report output format (table|csv|json)")
+
+	return cmd
+}
+
+// addTransactionSourceFlags adds flags for reading transactions from csv
+// files or fetching them from plaid
+func addTransactionSourceFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("input", nil, "Transactions csv files to read instead of fetching from plaid")
+	flags.String("category-delimiter", ledger.DefaultCategoryDelimiter, "Delimiter for joining category hierarchy")
+	flags.String("category-taxonomy", "", "Category taxonomy used when fetching from plaid (legacy|pfc); defaults to the configured taxonomy or legacy")
+	flags.String("format-post-date", ledger.DefaultPostDateFormat, "Input format for transaction post date")
+	flags.String("format-auth-date", ledger.DefaultAuthDateFormat, "Input format for transaction authorization date")
+	flags.String("csv-delimiter", ledger.DefaultDelimiter, "Input csv field delimiter; a single character or \"tab\"")
+	flags.String("decimal-separator", ledger.DefaultDecimalSeparator, "Input decimal separator for amounts")
+}
+
+// loadTransactions reads transactions from the input files, or fetches them
+// from plaid if there are none, keeping those within the start and end
+// dates. Transaction account IDs are replaced with configured account names
+// and dates are read in the given time zone. Fetched transactions have their
+// categories replaced with the chosen taxonomy's; input files are expected to
+// have been written with it.
+func loadTransactions(cmd *cobra.Command, location *time.Location, start, end time.Time) ([]ledger.Transaction, error) {
+	flags := cmd.Flags()
+
+	options := ledger.NewWriteOptions()
+	options.Location = location
+	options.CategoryDelimiter, _ = flags.GetString("category-delimiter")
+	options.PostDateFormat, _ = flags.GetString("format-post-date")
+	options.AuthDateFormat, _ = flags.GetString("format-auth-date")
+	options.Dialect.Delimiter, _ = flags.GetString("csv-delimiter")
+	options.Dialect.DecimalSeparator, _ = flags.GetString("decimal-separator")
+
+	var transactions []ledger.Transaction
+	inputs, _ := flags.GetStringSlice("input")
+	if len(inputs) > 0 {
+		for _, input := range inputs {
+			f, err := os.Open(input)
+			if err != nil {
+				return nil, fmt.Errorf("open input file: %w", err)
+			}
+			read, err := ledger.ReadTransactions(f, options)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read transactions from %q: %w", input, err)
+			}
+			transactions = append(transactions, read...)
+		}
+	} else {
+		if start.IsZero() || end.IsZero() {
+			return nil, fmt.Errorf("start and end dates are required when fetching from plaid")
+		}
+
+		environment, _ := flags.GetString("environment")
+		if !confirmEnvironment(cmd, environment) {
+			return nil, fmt.Errorf("canceled")
+		}
+
+		configPath, err := getConfigPath(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("get config path: %w", err)
+		}
+
+		config, err := ledger.LoadConfig(configPath, environment)
+		if err != nil {
+			return nil, fmt.Errorf("load config from file: %w", err)
+		}
+
+		taxonomy, err := getCategoryTaxonomy(cmd, config)
+		if err != nil {
+			return nil, fmt.Errorf("parse category taxonomy: %w", err)
+		}
+
+		activity, err := ledger.RequestActivity(config, start, end, ledger.RefreshThresholdLimit, false)
+		if err != nil {
+			return nil, fmt.Errorf("request activity from plaid: %w", err)
+		}
+
+		for _, item := range activity {
+			item.In(location)
+			itemConfig := config.Items[item.ID]
+			for _, transaction := range item.Transactions {
+				if name, ok := itemConfig.Transactions[transaction.AccountID]; ok {
+					transaction.AccountID = name
+				}
+				transaction.Category = transaction.Categories(taxonomy)
+				transactions = append(transactions, transaction)
+			}
+		}
+	}
+
+	var filtered []ledger.Transaction
+	for _, transaction := range transactions {
+		date := ledger.TransactionDate(transaction)
+		if (!start.IsZero() && date.Before(start)) || (!end.IsZero() && date.After(end)) {
+			continue
+		}
+		filtered = append(filtered, transaction)
+	}
+
+	return filtered, nil
+}
+
+// readEnvironmentConfig reads the config for the environment flag without
+// resolving secrets, for commands that don't request data from plaid
+func readEnvironmentConfig(cmd *cobra.Command) (*ledger.Config, error) {
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("get config path: %w", err)
+	}
+
+	data, _, err := ledger.ReadConfigFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	configs, err := ledger.ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+
+	environment, _ := cmd.Flags().GetString("environment")
+	config, ok := configs[environment]
+	if !ok {
+		return nil, fmt.Errorf("unknown environment: %q", environment)
+	}
+	config.Environment = environment
+
+	return config, nil
+}
+
+func spendingReport(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	outputFormat, _ := flags.GetString("output-format")
+	switch outputFormat {
+	case outputFormatTable, outputFormatCSV, outputFormatJSON:
+	default:
+		return fmt.Errorf("unknown output format: %q", outputFormat)
+	}
+
+	// the config is only needed for its time zone when reading input files,
+	// which don't require one
+	config, err := readEnvironmentConfig(cmd)
+	if errors.Is(err, fs.ErrNotExist) {
+		config = nil
+	} else if err != nil {
+		return err
+	}
+
+	location, err := getLocation(cmd, config)
+	if err != nil {
+		return fmt.Errorf("load time zone: %w", err)
+	}
+
+	var start, end time.Time
+	if startDate, _ := flags.GetString("start"); startDate != "" {
+		start, err = time.ParseInLocation(time.DateOnly, startDate, location)
+		if err != nil {
+			return fmt.Errorf("parse start date: %w", err)
+		}
+	}
+	if endDate, _ := flags.GetString("end"); endDate != "" {
+		end, err = time.ParseInLocation(time.DateOnly, endDate, location)
+		if err != nil {
+			return fmt.Errorf("parse end date: %w", err)
+		}
+	}
+
+	transactions, err := loadTransactions(cmd, location, start, end)
+	if err != nil {
+		return fmt.Errorf("load transactions: %w", err)
+	}
+
+	delimiter, _ := flags.GetString("category-delimiter")
+	depth, _ := flags.GetInt("depth")
+	report := ledger.NewSpendingReport(transactions, delimiter, depth)
+
+	switch outputFormat {
+	case outputFormatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+		if err != nil {
+			return fmt.Errorf("encode report: %w", err)
+		}
+	case outputFormatCSV:
+		output := csv.NewWriter(os.Stdout)
+		output.Write(append(append([]string{"Category"}, report.Months...), "Total", "Average", "Change"))
+		for _, category := range report.Categories {
+			output.Write(reportRow(category.Category, category.Amounts, category.Total, category.Average, category.Change))
+		}
+		output.Write(reportRow("Total", report.Totals, report.Total, report.Average, nil))
+		output.Flush()
+		if err = output.Error(); err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Category\t%s\tTotal\tAverage\tChange\t\n", strings.Join(report.Months, "\t"))
+		for _, category := range report.Categories {
+			names := strings.Split(category.Category, delimiter)
+			name := strings.Repeat("  ", category.Depth-1) + names[len(names)-1]
+			fmt.Fprintf(w, "%s\t\n", strings.Join(reportRow(name, category.Amounts, category.Total, category.Average, category.Change), "\t"))
+		}
+		fmt.Fprintf(w, "%s\t\n", strings.Join(reportRow("Total", report.Totals, report.Total, report.Average, nil), "\t"))
+		w.Flush()
+	}
+
+	return nil
+}
+
+func reportRow(name string, amounts []float64, total, average float64, change *float64) []string {
+	row := []string{name}
+	for _, amount := range amounts {
+		row = append(row, fmt.Sprintf(ledger.DefaultAmountFormat, amount))
+	}
+	row = append(row, fmt.Sprintf(ledger.DefaultAmountFormat, total), fmt.Sprintf(ledger.DefaultAmountFormat, average))
+	if change != nil {
+		row = append(row, fmt.Sprintf("%+0.1f%%", *change))
+	} else {
+		row = append(row, "")
+	}
+	return row
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subtlepseudonym/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+func securitiesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "securities",
+		Short:        "List securities without a ticker or configured symbol, for adding to the securities config",
+		Args:         cobra.NoArgs,
+		RunE:         listSecurities,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.Int("days", 90, "Days of investment activity to request")
+	flags.String("archive", "", "Archive directory to list securities from instead of requesting activity")
+	flags.Bool("all", false, "Include securities with a ticker or option symbol")
+
+	return cmd
+}
+
+func listSecurities(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	environment, _ := flags.GetString("environment")
+	var archive *ledger.Archive
+	if archivePath, _ := flags.GetString("archive"); archivePath != "" {
+		var err error
+		archive, err = ledger.OpenArchive(archivePath)
+		if err != nil {
+			return fmt.Errorf("open archive: %w", err)
+		}
+		if !flags.Changed("environment") {
+			environment = archive.Environment
+		} else if environment != archive.Environment {
+			return fmt.Errorf("archive was fetched from environment %q", archive.Environment)
+		}
+	} else if !confirmEnvironment(cmd, environment) {
+		return nil
+	}
+
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	config, err := ledger.LoadConfig(configPath, environment)
+	if err != nil {
+		return fmt.Errorf("load config from file: %w", err)
+	}
+
+	var activity []*ledger.ItemData
+	if archive != nil {
+		activity, err = archive.Items()
+		if err != nil {
+			return fmt.Errorf("load archived activity: %w", err)
+		}
+	} else {
+		days, _ := flags.GetInt("days")
+		end := time.Now()
+		activity, err = ledger.RequestActivity(config, end.AddDate(0, 0, -days), end, ledger.RefreshThresholdLimit, false)
+		if err != nil {
+			return fmt.Errorf("request activity from plaid: %w", err)
+		}
+	}
+
+	all, _ := flags.GetBool("all")
+	unmapped := ledger.UnmappedSecurities(config, activity, all)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ITEM\tSECURITY ID\tCUSIP\tISIN\tSEDOL\tTICKER\tTYPE\tNAME\tSYMBOL")
+	for _, u := range unmapped {
+		itemName := u.ItemID
+		if itemConfig, ok := config.Items[u.ItemID]; ok {
+			itemName = itemConfig.Name
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			itemName,
+			u.Security.ID,
+			orDash(u.Security.CUSIP),
+			orDash(u.Security.ISIN),
+			orDash(u.Security.SEDOL),
+			orDash(u.Security.TickerSymbol),
+			orDash(u.Security.Type),
+			u.Security.Name,
+			u.Symbol,
+		)
+	}
+	w.Flush()
+
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
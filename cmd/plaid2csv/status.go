@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/subtlepseudonym/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+func statusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show the health of each configured item, exiting non-zero if any need attention",
+		Args:         cobra.NoArgs,
+		RunE:         itemStatus,
+		SilenceUsage: true,
+	}
+
+	flags := cmd.Flags()
+	flags.Bool("json", false, "Output status as JSON")
+
+	return cmd
+}
+
+func itemStatus(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	environment, _ := flags.GetString("environment")
+	if !confirmEnvironment(cmd, environment) {
+		return nil
+	}
+
+	configPath, err := getConfigPath(cmd)
+	if err != nil {
+		return fmt.Errorf("get config path: %w", err)
+	}
+
+	config, err := ledger.LoadConfig(configPath, environment)
+	if err != nil {
+		return fmt.Errorf("load config from file: %w", err)
+	}
+
+	health := ledger.RequestItemHealth(config)
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Name < health[j].Name
+	})
+
+	outputJSON, _ := flags.GetBool("json")
+	if outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(health)
+		if err != nil {
+			return fmt.Errorf("encode status: %w", err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for i, h := range health {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+
+			state := "ok"
+			if h.NeedsAttention() {
+				state = "needs attention"
+			}
+
+			fmt.Fprintf(w, "%s\t%s (%s)\n", h.Name, h.ID, state)
+			fmt.Fprintf(w, "  Institution\t%s\n", h.Item.InstitutionID)
+			fmt.Fprintf(w, "  Products\t%s\n", strings.Join(h.Item.Products, ", "))
+			fmt.Fprintf(w, "  Billed products\t%s\n", strings.Join(h.Item.BilledProducts, ", "))
+			fmt.Fprintf(w, "  Consent expiration\t%s\n", formatStatusTime(h.Item.ConsentExpirationTime))
+			fmt.Fprintf(w, "  Transactions updated\t%s\n", formatStatusTime(h.Status.Transactions.LastSuccessfulUpdate))
+			fmt.Fprintf(w, "  Transactions failed\t%s\n", formatStatusTime(h.Status.Transactions.LastFailedUpdate))
+			fmt.Fprintf(w, "  Investments updated\t%s\n", formatStatusTime(h.Status.Investments.LastSuccessfulUpdate))
+			fmt.Fprintf(w, "  Investments failed\t%s\n", formatStatusTime(h.Status.Investments.LastFailedUpdate))
+			fmt.Fprintf(w, "  Last webhook\t%s %s\n", formatStatusTime(h.Status.LastWebhook.SentAt), h.Status.LastWebhook.CodeSent)
+			for _, problem := range h.Problems {
+				fmt.Fprintf(w, "  Problem\t%s\n", problem)
+			}
+		}
+		w.Flush()
+	}
+
+	var attention int
+	for _, h := range health {
+		if h.NeedsAttention() {
+			attention += 1
+		}
+	}
+	if attention > 0 {
+		return fmt.Errorf("%d of %d items need attention", attention, len(health))
+	}
+
+	return nil
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
@@ -0,0 +1,153 @@
+package ledger
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+type ColumnConfig struct {
+	Name     string `yaml:"name"`
+	Template string `yaml:"template"`
+}
+
+type ColumnsConfig struct {
+	Transactions []ColumnConfig `yaml:"transactions"`
+	Investments  []ColumnConfig `yaml:"investments"`
+}
+
+// TransactionRecord is the data available to transactions column templates.
+// Cash and fee investment transactions are written as transactions too, with
+// only the fields they share with a Transaction set.
+type TransactionRecord struct {
+	Transaction
+	Account  string // configured account name
+	ItemName string
+	Payee    string
+	Currency string
+	Category string // category hierarchy joined with the category delimiter
+
+	TransferID      string // set if the transaction is one side of a matched transfer
+	TransferAccount string // configured name of the other account in the transfer
+}
+
+// InvestmentRecord is the data available to investments column templates
+type InvestmentRecord struct {
+	InvestmentTransaction
+	Security Security
+	Account  string // configured account name
+	ItemName string
+	Currency string
+	Category string // security sector and industry
+}
+
+var DefaultTransactionColumns = []ColumnConfig{
+	{Name: "Post Date", Template: "{{postDate .Date}}"},
+	{Name: "Authorized Date", Template: "{{authDate .AuthorizedDate}}"},
+	{Name: "Account", Template: "{{.Account}}"},
+	{Name: "Account Name", Template: "{{.ItemName}}"},
+	{Name: "Check Number", Template: "{{.CheckNumber}}"},
+	{Name: "Payee", Template: "{{.Payee}}"},
+	{Name: "Amount", Template: "{{amount .Amount}}"},
+	{Name: "Currency", Template: "{{.Currency}}"},
+	{Name: "Category", Template: "{{.Category}}"},
+	{Name: "Transaction ID", Template: "{{.ID}}"},
+}
+
+// TransactionDatetimeColumns may be appended to a transactions layout. Plaid
+// only provides datetimes for some institutions, leaving these empty otherwise.
+var TransactionDatetimeColumns = []ColumnConfig{
+	{Name: "Datetime", Template: "{{datetime .Time}}"},
+	{Name: "Authorized Datetime", Template: "{{datetime .AuthorizedTime}}"},
+}
+
+// TransferColumns may be appended to a transactions layout to mark matched
+// transfers
+var TransferColumns = []ColumnConfig{
+	{Name: "Transfer ID", Template: "{{.TransferID}}"},
+	{Name: "Transfer Account", Template: "{{.TransferAccount}}"},
+}
+
+// OptionColumns may be appended to an investments layout to describe option
+// contracts; they're empty for other securities
+var OptionColumns = []ColumnConfig{
+	{Name: "Symbol", Template: "{{commodity .Security}}"},
+	{Name: "Contract Type", Template: "{{with .Security.OptionContract}}{{.ContractType}}{{end}}"},
+	{Name: "Expiration", Template: "{{with .Security.OptionContract}}{{postDate .ExpirationDate}}{{end}}"},
+	{Name: "Strike", Template: "{{with .Security.OptionContract}}{{price .StrikePrice}}{{end}}"},
+	{Name: "Underlying", Template: "{{with .Security.OptionContract}}{{.UnderlyingSecurityTicker}}{{end}}"},
+}
+
+var DefaultInvestmentColumns = []ColumnConfig{
+	{Name: "Post Date", Template: "{{postDate .Date}}"},
+	{Name: "Account", Template: "{{.Account}}"},
+	{Name: "Account Name", Template: "{{.ItemName}}"},
+	{Name: "Name", Template: "{{.Security.Name}}"},
+	{Name: "Quantity", Template: "{{quantity .Quantity}}"},
+	{Name: "Amount", Template: "{{amount .Amount}}"},
+	{Name: "Price", Template: "{{price .Price}}"},
+	{Name: "Transaction ID", Template: "{{.ID}}"},
+	{Name: "Fee", Template: "{{amount .Fees}}"},
+	{Name: "Fee Currency", Template: "{{.Currency}}"},
+	{Name: "Ticker Symbol", Template: "{{.Security.Symbol}}"},
+	{Name: "Category", Template: "{{.Category}}"},
+}
+
+// Columns is a compiled column layout for csv output
+type Columns struct {
+	names     []string
+	templates []*template.Template
+}
+
+// NewColumns compiles column templates. Template functions format values
+// using the given options, so changes to the options after compiling are
+// reflected in the output.
+func NewColumns(configs []ColumnConfig, options *WriteOptions) (*Columns, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+
+	funcs := template.FuncMap{
+		"postDate":  func(d Date) string { return d.Format(options.PostDateFormat) },
+		"authDate":  func(d Date) string { return d.Format(options.AuthDateFormat) },
+		"datetime":  options.formatDatetime,
+		"amount":    options.formatAmount,
+		"price":     options.formatPrice,
+		"quantity":  options.formatQuantity,
+		"commodity": CommoditySymbol,
+		"join":      func(s []string) string { return strings.Join(s, options.CategoryDelimiter) },
+	}
+
+	columns := &Columns{
+		names:     make([]string, 0, len(configs)),
+		templates: make([]*template.Template, 0, len(configs)),
+	}
+	for _, config := range configs {
+		tmpl, err := template.New(config.Name).Funcs(funcs).Option("missingkey=error").Parse(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("parse column %q template: %w", config.Name, err)
+		}
+		columns.names = append(columns.names, config.Name)
+		columns.templates = append(columns.templates, tmpl)
+	}
+
+	return columns, nil
+}
+
+func (c *Columns) Header() []string {
+	return c.names
+}
+
+// Record executes each column template against data
+func (c *Columns) Record(data interface{}) ([]string, error) {
+	record := make([]string, len(c.templates))
+	for i, tmpl := range c.templates {
+		var b strings.Builder
+		err := tmpl.Execute(&b, data)
+		if err != nil {
+			return nil, fmt.Errorf("execute column %q template: %w", c.names[i], err)
+		}
+		record[i] = b.String()
+	}
+	return record, nil
+}
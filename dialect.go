@@ -0,0 +1,210 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultDelimiter        = ","
+	DefaultDecimalSeparator = "."
+
+	ByteOrderMark = "\ufeff"
+)
+
+// Dialect describes how csv output is formatted, allowing output to be
+// imported by spreadsheet software expecting something other than RFC 4180
+type Dialect struct {
+	Delimiter        string `yaml:"delimiter,omitempty"` // single character, or "tab"
+	AlwaysQuote      bool   `yaml:"always_quote,omitempty"`
+	CRLF             bool   `yaml:"crlf,omitempty"`
+	BOM              bool   `yaml:"bom,omitempty"` // written only at the start of a file
+	DecimalSeparator string `yaml:"decimal_separator,omitempty"`
+}
+
+// CSVConfig holds the default dialect for csv outputs and per-output
+// dialects, which replace the default entirely when set
+type CSVConfig struct {
+	Dialect      `yaml:",inline"`
+	Transactions *Dialect `yaml:"transactions,omitempty"`
+	Investments  *Dialect `yaml:"investments,omitempty"`
+	Gains        *Dialect `yaml:"gains,omitempty"`
+	Form8949     *Dialect `yaml:"form_8949,omitempty"`
+	Prices       *Dialect `yaml:"prices,omitempty"` // used by the csv price format
+}
+
+func NewDialect() Dialect {
+	return Dialect{
+		Delimiter:        DefaultDelimiter,
+		DecimalSeparator: DefaultDecimalSeparator,
+	}
+}
+
+// Output returns the dialect for an output, falling back to the default
+func (c CSVConfig) Output(dialect *Dialect) Dialect {
+	if dialect != nil {
+		return *dialect
+	}
+	return c.Dialect
+}
+
+// Comma returns the delimiter rune, defaulting to a comma if unset
+func (d Dialect) Comma() (rune, error) {
+	switch d.Delimiter {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	comma, size := utf8.DecodeRuneInString(d.Delimiter)
+	if size != len(d.Delimiter) {
+		return 0, fmt.Errorf("delimiter must be a single character: %q", d.Delimiter)
+	}
+	if comma == '"' || comma == '\r' || comma == '\n' || comma == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter: %q", d.Delimiter)
+	}
+	return comma, nil
+}
+
+func (d Dialect) validate() error {
+	if _, err := d.Comma(); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(d.DecimalSeparator) > 1 {
+		return fmt.Errorf("decimal separator must be a single character: %q", d.DecimalSeparator)
+	}
+	return nil
+}
+
+// decimal replaces the decimal point in a formatted number with the decimal
+// separator
+func (d Dialect) decimal(number string) string {
+	if d.DecimalSeparator == "" || d.DecimalSeparator == DefaultDecimalSeparator {
+		return number
+	}
+	return strings.Replace(number, ".", d.DecimalSeparator, 1)
+}
+
+// parseDecimal reverses decimal, returning a number parseable by strconv
+func (d Dialect) parseDecimal(number string) string {
+	if d.DecimalSeparator == "" || d.DecimalSeparator == DefaultDecimalSeparator {
+		return number
+	}
+	return strings.Replace(number, d.DecimalSeparator, ".", 1)
+}
+
+// parseAmount reads a number from an amount written with the dialect's
+// decimal separator, e.g. "1.234,56 EUR" with a comma decimal separator.
+// Grouping separators, commodity symbols and spaces are ignored. It returns
+// false if the amount has no digits.
+func (d Dialect) parseAmount(amount string) (float64, bool, error) {
+	decimal := '.'
+	if d.DecimalSeparator != "" {
+		decimal, _ = utf8.DecodeRuneInString(d.DecimalSeparator)
+	}
+
+	var number strings.Builder
+	var digits bool
+	for _, r := range amount {
+		switch {
+		case r >= '0' && r <= '9':
+			number.WriteRune(r)
+			digits = true
+		case r == decimal:
+			number.WriteRune('.')
+		case r == '-':
+			number.WriteRune(r)
+		}
+	}
+	if !digits {
+		return 0, false, nil
+	}
+
+	value, err := strconv.ParseFloat(number.String(), 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse amount %q", strings.TrimSpace(amount))
+	}
+	return value, true, nil
+}
+
+// RecordWriter writes csv records. It is satisfied by *csv.Writer.
+type RecordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// NewRecordWriter returns a RecordWriter formatting records with the given
+// dialect. The byte order mark is not written; see ByteOrderMark.
+func NewRecordWriter(output io.Writer, dialect Dialect) (RecordWriter, error) {
+	comma, err := dialect.Comma()
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect.AlwaysQuote {
+		return &quotingWriter{
+			w:     bufio.NewWriter(output),
+			comma: comma,
+			crlf:  dialect.CRLF,
+		}, nil
+	}
+
+	writer := csv.NewWriter(output)
+	writer.Comma = comma
+	writer.UseCRLF = dialect.CRLF
+	return writer, nil
+}
+
+// quotingWriter writes records with every field quoted, which csv.Writer
+// doesn't support
+type quotingWriter struct {
+	w     *bufio.Writer
+	comma rune
+	crlf  bool
+	err   error
+}
+
+func (q *quotingWriter) Write(record []string) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	var b strings.Builder
+	for i, field := range record {
+		if i > 0 {
+			b.WriteRune(q.comma)
+		}
+		if q.crlf {
+			// match csv.Writer, which translates newlines within fields
+			field = strings.ReplaceAll(strings.ReplaceAll(field, "\r\n", "\n"), "\n", "\r\n")
+		}
+		b.WriteByte('"')
+		b.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		b.WriteByte('"')
+	}
+	if q.crlf {
+		b.WriteString("\r\n")
+	} else {
+		b.WriteByte('\n')
+	}
+
+	_, q.err = q.w.WriteString(b.String())
+	return q.err
+}
+
+func (q *quotingWriter) Flush() {
+	if err := q.w.Flush(); err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *quotingWriter) Error() error {
+	return q.err
+}
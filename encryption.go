@@ -0,0 +1,167 @@
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/term"
+)
+
+const (
+	PassphraseEnv = "LEDGER_CONFIG_PASSPHRASE"
+
+	ageHeader = "age-encryption.org/v1"
+)
+
+// cached so that decrypting and re-encrypting a config only prompts once
+var configPassphrase string
+
+func IsEncrypted(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte(armor.Header)) || bytes.HasPrefix(data, []byte(ageHeader))
+}
+
+// ConfigPassphrase returns the passphrase for an encrypted config, read from
+// the environment or prompted for on the terminal
+func ConfigPassphrase() (string, error) {
+	if configPassphrase != "" {
+		return configPassphrase, nil
+	}
+
+	if passphrase, ok := os.LookupEnv(PassphraseEnv); ok {
+		configPassphrase = passphrase
+		return configPassphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("config is encrypted and %s is not set", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Config passphrase: ")
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	if len(b) == 0 {
+		return "", fmt.Errorf("empty passphrase")
+	}
+
+	configPassphrase = string(b)
+	return configPassphrase, nil
+}
+
+func DecryptConfig(data []byte, passphrase string) ([]byte, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("create identity: %w", err)
+	}
+
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+
+	r, err := age.Decrypt(src, identity)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read plaintext: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// EncryptConfig encrypts data with a passphrase as an ascii armored age file
+func EncryptConfig(data []byte, passphrase string) ([]byte, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("create recipient: %w", err)
+	}
+
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, fmt.Errorf("write ciphertext: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, fmt.Errorf("close encryption: %w", err)
+	}
+	if err = armored.Close(); err != nil {
+		return nil, fmt.Errorf("close armor: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ReadConfigFile reads a config file, decrypting it if necessary
+func ReadConfigFile(filepath string) ([]byte, bool, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, false, fmt.Errorf("read file: %w", err)
+	}
+
+	if !IsEncrypted(data) {
+		return data, false, nil
+	}
+
+	passphrase, err := ConfigPassphrase()
+	if err != nil {
+		return nil, true, fmt.Errorf("get passphrase: %w", err)
+	}
+
+	data, err = DecryptConfig(data, passphrase)
+	if err != nil {
+		return nil, true, fmt.Errorf("decrypt config: %w", err)
+	}
+
+	return data, true, nil
+}
+
+// WriteConfigFile replaces a config file, encrypting it if requested. The file
+// is written beside the original and renamed into place so that a failed
+// write doesn't leave a truncated config behind.
+func WriteConfigFile(filepath string, data []byte, encrypt bool) error {
+	if encrypt {
+		passphrase, err := ConfigPassphrase()
+		if err != nil {
+			return fmt.Errorf("get passphrase: %w", err)
+		}
+
+		data, err = EncryptConfig(data, passphrase)
+		if err != nil {
+			return fmt.Errorf("encrypt config: %w", err)
+		}
+	}
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(filepath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp := filepath + ".tmp"
+	err := os.WriteFile(tmp, data, mode)
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	err = os.Rename(tmp, filepath)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,389 @@
+package ledger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type JournalFormat string
+
+const (
+	JournalFormatLedger    JournalFormat = "ledger"
+	JournalFormatBeancount JournalFormat = "beancount"
+
+	DefaultJournalFormat = JournalFormatLedger
+
+	// accounts balancing transactions whose counterpart plaid doesn't know,
+	// including realized gains and shares transferred in or out
+	UnknownExpenseAccount = "Expenses:Unknown"
+	UnknownIncomeAccount  = "Income:Unknown"
+	UnknownEquityAccount  = "Equity:Unknown"
+)
+
+func ParseJournalFormat(format string) (JournalFormat, error) {
+	switch f := JournalFormat(format); f {
+	case JournalFormatLedger, JournalFormatBeancount:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown journal format: %q", format)
+	}
+}
+
+// TransactionEntries builds a journal entry for each of item's transactions
+// and investment cash movements, posting to its configured account and
+// balanced by an elided posting to an unknown expense or income account.
+// Entries for legs of matched transfers are merged by MergeTransferEntries.
+func TransactionEntries(itemConfig *ItemConfig, item *ItemData, options *WriteOptions) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for _, transaction := range item.Transactions {
+		if options.OmitPending && transaction.Pending {
+			continue
+		}
+
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Transactions, item, transaction.AccountID, transaction.ID)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		entry := options.journalEntry(transaction, accountName, options.payee(transaction))
+		if transfer, ok := options.Transfers[transaction.ID]; ok {
+			entry.transferID = transfer.ID
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, transaction := range item.Investments {
+		known := item.Securities[transaction.SecurityID]
+		if transaction.output(known) != outputTransactions {
+			continue
+		}
+		transaction = transaction.normalize(known)
+
+		// cash movements often have no security
+		payee := transaction.Name
+		if transaction.SecurityID != "" {
+			security, ok, err := options.security(itemConfig, item, transaction.SecurityID, transaction.ID)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+			payee = security.Name
+		}
+
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Investments, item, transaction.AccountID, transaction.ID)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		entries = append(entries, options.journalEntry(Transaction{
+			ID:                 transaction.ID,
+			Amount:             transaction.Amount,
+			ISOCurrency:        transaction.ISOCurrency,
+			UnofficialCurrency: transaction.UnofficialCurrency,
+			Date:               transaction.Date,
+		}, accountName, payee))
+	}
+
+	return entries, nil
+}
+
+// InvestmentEntries builds a journal entry for each of item's investment
+// transactions that moves shares. Buys post the shares at their total cost
+// against the cash paid, and sells post them at their total price against the
+// cash received, balanced by an unknown income account for the realized gain.
+// Splits and stock distributions post the change in shares at zero cost.
+// Reverse splits and other transactions, such as transfers of shares, are
+// balanced by an unknown equity account.
+func InvestmentEntries(itemConfig *ItemConfig, item *ItemData, options *WriteOptions) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for _, transaction := range item.Investments {
+		if transaction.output(item.Securities[transaction.SecurityID]) != outputInvestments {
+			continue
+		}
+
+		security, ok, err := options.security(itemConfig, item, transaction.SecurityID, transaction.ID)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		transaction = transaction.normalize(security)
+
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Investments, item, transaction.AccountID, transaction.ID)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		currency := transaction.ISOCurrency
+		if transaction.UnofficialCurrency != "" {
+			currency = transaction.UnofficialCurrency
+		}
+
+		shares := JournalPosting{
+			Account:   accountName,
+			Amount:    transaction.Quantity,
+			HasAmount: true,
+			Commodity: CommoditySymbol(security),
+			Metadata:  map[string]string{options.JournalIDKey: transaction.ID},
+			shares:    true,
+		}
+		cash := JournalPosting{
+			Account:   accountName,
+			Amount:    -transaction.Amount,
+			HasAmount: true,
+			Commodity: currency,
+		}
+
+		var postings []JournalPosting
+		switch {
+		case transaction.adjustsShares():
+			shares.HasCost = true
+			shares.CostCommodity = currency
+			postings = []JournalPosting{shares}
+			if transaction.Quantity < 0 {
+				// beancount reduces lots at their cost, which must balance
+				postings = append(postings, JournalPosting{Account: UnknownEquityAccount})
+			}
+		case transaction.Type == InvestmentBuy:
+			shares.Cost, shares.CostCommodity, shares.HasCost = transaction.Amount, currency, true
+			postings = []JournalPosting{shares, cash}
+		case transaction.Type == InvestmentSell:
+			shares.Cost, shares.CostCommodity, shares.HasCost = -transaction.Amount, currency, true
+			postings = []JournalPosting{shares, cash, {Account: UnknownIncomeAccount}}
+		default:
+			if transaction.Quantity != 0 {
+				postings = append(postings, shares)
+			} else {
+				cash.Metadata = shares.Metadata
+			}
+			if transaction.Amount != 0 {
+				postings = append(postings, cash)
+			}
+			if len(postings) == 0 {
+				continue
+			}
+			postings = append(postings, JournalPosting{Account: UnknownEquityAccount})
+		}
+
+		entries = append(entries, JournalEntry{
+			Date:     transaction.Date.Time,
+			Payee:    security.Name,
+			Postings: postings,
+		})
+	}
+
+	return entries, nil
+}
+
+// journalEntry returns a balanced entry for a single transaction. Plaid
+// amounts are positive for outflows, the opposite of journal postings.
+func (o *WriteOptions) journalEntry(transaction Transaction, accountName, payee string) JournalEntry {
+	currency := transaction.ISOCurrency
+	if transaction.UnofficialCurrency != "" {
+		currency = transaction.UnofficialCurrency
+	}
+
+	balance := UnknownExpenseAccount
+	if transaction.Amount < 0 {
+		balance = UnknownIncomeAccount
+	}
+
+	return JournalEntry{
+		Date:    transaction.Date.Time,
+		Payee:   payee,
+		Pending: transaction.Pending,
+		Postings: []JournalPosting{
+			{
+				Account:   accountName,
+				Amount:    -transaction.Amount,
+				HasAmount: true,
+				Commodity: currency,
+				Metadata:  map[string]string{o.JournalIDKey: transaction.ID},
+			},
+			{Account: balance},
+		},
+	}
+}
+
+// MergeTransferEntries replaces the entries for both legs of a matched
+// transfer with a single entry posting to both accounts, dated and named
+// after the outflow. Legs whose counterpart isn't among entries, such as one
+// already in a journal, are left balanced by an unknown account. Entries are
+// returned sorted by date.
+func MergeTransferEntries(entries []JournalEntry) []JournalEntry {
+	legs := make(map[string][]int)
+	for i, entry := range entries {
+		if entry.transferID != "" {
+			legs[entry.transferID] = append(legs[entry.transferID], i)
+		}
+	}
+
+	var merged []JournalEntry
+	for i, entry := range entries {
+		indexes := legs[entry.transferID]
+		if entry.transferID == "" || len(indexes) != 2 {
+			merged = append(merged, entry)
+			continue
+		}
+		if i != indexes[0] {
+			// merged with the first leg
+			continue
+		}
+
+		outflow, inflow := entries[indexes[0]], entries[indexes[1]]
+		if outflow.Postings[0].Amount > 0 {
+			outflow, inflow = inflow, outflow
+		}
+		merged = append(merged, JournalEntry{
+			Date:     outflow.Date,
+			Payee:    outflow.Payee,
+			Pending:  outflow.Pending || inflow.Pending,
+			Postings: []JournalPosting{outflow.Postings[0], inflow.Postings[0]},
+		})
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Date.Before(merged[j].Date)
+	})
+
+	return merged
+}
+
+// WriteJournal writes entries as ledger or beancount transactions, separated
+// by blank lines. Metadata is written sorted by key. Share costs are written
+// as total prices in ledger, and as total costs of shares bought or total
+// prices of shares sold from existing lots in beancount. Entries with symbols
+// that can't be written as beancount commodities are skipped with a warning;
+// configure a symbol for those securities.
+func WriteJournal(output io.Writer, entries []JournalEntry, format JournalFormat, options *WriteOptions) error {
+	var b strings.Builder
+entries:
+	for _, entry := range entries {
+		b.Reset()
+		flag := "*"
+		if entry.Pending {
+			flag = "!"
+		}
+
+		date := entry.Date.Format(time.DateOnly)
+		switch format {
+		case JournalFormatLedger:
+			// a semicolon would start a comment
+			fmt.Fprintf(&b, "%s %s %s\n", date, flag, strings.ReplaceAll(entry.Payee, ";", ","))
+			writeJournalMetadata(&b, "    ; %s: %s\n", entry.Metadata, false)
+		case JournalFormatBeancount:
+			fmt.Fprintf(&b, "%s %s %s \"\"\n", date, flag, strconv.Quote(entry.Payee))
+			writeJournalMetadata(&b, "  %s: %s\n", entry.Metadata, true)
+		default:
+			return fmt.Errorf("unknown journal format: %q", format)
+		}
+
+		for _, posting := range entry.Postings {
+			amount, err := options.journalAmount(posting, format)
+			if err != nil {
+				log.Printf("Warning: skipped journal entry %s %q: %s\n", date, entry.Payee, err)
+				continue entries
+			}
+
+			switch format {
+			case JournalFormatLedger:
+				fmt.Fprintf(&b, "    %s", posting.Account)
+				if amount != "" {
+					fmt.Fprintf(&b, "  %s", amount)
+				}
+				b.WriteByte('\n')
+				writeJournalMetadata(&b, "        ; %s: %s\n", posting.Metadata, false)
+			case JournalFormatBeancount:
+				fmt.Fprintf(&b, "  %s", posting.Account)
+				if amount != "" {
+					fmt.Fprintf(&b, "  %s", amount)
+				}
+				b.WriteByte('\n')
+				writeJournalMetadata(&b, "    %s: %s\n", posting.Metadata, true)
+			}
+		}
+		b.WriteByte('\n')
+
+		if _, err := io.WriteString(output, b.String()); err != nil {
+			return fmt.Errorf("write journal entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// journalAmount formats a posting's amount, commodity and cost, or returns
+// an empty string if the amount is elided. Journal amounts always use a
+// decimal point, regardless of the csv dialect.
+func (o *WriteOptions) journalAmount(posting JournalPosting, format JournalFormat) (string, error) {
+	if !posting.HasAmount {
+		return "", nil
+	}
+
+	number := fmt.Sprintf(o.AmountFormat, posting.Amount)
+	if posting.shares {
+		number = strconv.FormatFloat(posting.Amount, 'f', -1, 64)
+	}
+	commodity, err := journalCommodity(posting.Commodity, format)
+	if err != nil {
+		return "", err
+	}
+	amount := strings.TrimSpace(number + " " + commodity)
+	if !posting.HasCost {
+		return amount, nil
+	}
+
+	costCommodity, err := journalCommodity(posting.CostCommodity, format)
+	if err != nil {
+		return "", err
+	}
+	cost := strings.TrimSpace(fmt.Sprintf(o.AmountFormat, posting.Cost) + " " + costCommodity)
+
+	switch {
+	case format == JournalFormatLedger:
+		return fmt.Sprintf("%s @@ %s", amount, cost), nil
+	case posting.Amount < 0:
+		// reduce existing lots, booked by the account's booking method
+		return fmt.Sprintf("%s {} @@ %s", amount, cost), nil
+	default:
+		return fmt.Sprintf("%s {{%s}}", amount, cost), nil
+	}
+}
+
+// journalCommodity returns a commodity as written in the journal format
+func journalCommodity(commodity string, format JournalFormat) (string, error) {
+	if commodity == "" {
+		return "", nil
+	}
+	if format == JournalFormatLedger {
+		return ledgerCommodity(commodity), nil
+	}
+
+	symbol, ok := beancountCommodity(commodity)
+	if !ok {
+		return "", fmt.Errorf("%q isn't a valid beancount commodity", commodity)
+	}
+	return symbol, nil
+}
+
+func writeJournalMetadata(b *strings.Builder, layout string, metadata map[string]string, quote bool) {
+	for _, key := range sortedKeys(metadata) {
+		value := metadata[key]
+		if quote {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(b, layout, key, value)
+	}
+}
@@ -0,0 +1,106 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GeoJSONFeature is a point feature locating a single transaction
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // longitude, latitude
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// TransactionFeatures returns point features for transactions in item with
+// coordinates. Plaid leaves coordinates null when unknown, which decode as
+// zero, so transactions at exactly 0,0 are skipped.
+func TransactionFeatures(itemConfig *ItemConfig, item *ItemData, options *WriteOptions) []GeoJSONFeature {
+	var features []GeoJSONFeature
+	for _, transaction := range item.Transactions {
+		if options.OmitPending && transaction.Pending {
+			continue
+		}
+
+		location := transaction.Location
+		if location.Latitude == 0 && location.Longitude == 0 {
+			continue
+		}
+
+		account, ok := itemConfig.Transactions[transaction.AccountID]
+		if !ok {
+			// reported by WriteTransactions
+			continue
+		}
+
+		currency := transaction.ISOCurrency
+		if transaction.UnofficialCurrency != "" {
+			currency = transaction.UnofficialCurrency
+		}
+
+		properties := map[string]interface{}{
+			"id":       transaction.ID,
+			"date":     transaction.Date.Format(time.DateOnly),
+			"payee":    options.payee(transaction),
+			"amount":   transaction.Amount,
+			"currency": currency,
+			"category": strings.Join(transaction.Categories(options.CategoryTaxonomy), options.CategoryDelimiter),
+			"account":  account,
+			"pending":  transaction.Pending,
+		}
+		for key, value := range map[string]string{
+			"address":      location.Address,
+			"city":         location.City,
+			"region":       location.Region,
+			"postal_code":  location.PostalCode,
+			"country":      location.Country,
+			"store_number": location.StoreNumber,
+		} {
+			if value != "" {
+				properties[key] = value
+			}
+		}
+
+		features = append(features, GeoJSONFeature{
+			Type: "Feature",
+			Geometry: GeoJSONPoint{
+				Type:        "Point",
+				Coordinates: [2]float64{location.Longitude, location.Latitude},
+			},
+			Properties: properties,
+		})
+	}
+
+	return features
+}
+
+// WriteGeoJSON writes features as a single feature collection
+func WriteGeoJSON(output io.Writer, features []GeoJSONFeature) error {
+	if features == nil {
+		features = []GeoJSONFeature{}
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: features,
+	})
+	if err != nil {
+		return fmt.Errorf("encode geojson: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package ledger
+
+import "math"
+
+type InvestmentType string
+
+const (
+	InvestmentBuy      InvestmentType = "buy"
+	InvestmentSell     InvestmentType = "sell"
+	InvestmentCancel   InvestmentType = "cancel"
+	InvestmentCash     InvestmentType = "cash"
+	InvestmentFee      InvestmentType = "fee"
+	InvestmentTransfer InvestmentType = "transfer"
+)
+
+type InvestmentSubtype string
+
+const (
+	SubtypeAccountFee                       InvestmentSubtype = "account fee"
+	SubtypeAdjustment                       InvestmentSubtype = "adjustment"
+	SubtypeAssignment                       InvestmentSubtype = "assignment"
+	SubtypeBuy                              InvestmentSubtype = "buy"
+	SubtypeBuyToCover                       InvestmentSubtype = "buy to cover"
+	SubtypeContribution                     InvestmentSubtype = "contribution"
+	SubtypeDeposit                          InvestmentSubtype = "deposit"
+	SubtypeDistribution                     InvestmentSubtype = "distribution"
+	SubtypeDividend                         InvestmentSubtype = "dividend"
+	SubtypeDividendReinvestment             InvestmentSubtype = "dividend reinvestment"
+	SubtypeExercise                         InvestmentSubtype = "exercise"
+	SubtypeExpire                           InvestmentSubtype = "expire"
+	SubtypeFundFee                          InvestmentSubtype = "fund fee"
+	SubtypeInterest                         InvestmentSubtype = "interest"
+	SubtypeInterestReceivable               InvestmentSubtype = "interest receivable"
+	SubtypeInterestReinvestment             InvestmentSubtype = "interest reinvestment"
+	SubtypeLegalFee                         InvestmentSubtype = "legal fee"
+	SubtypeLoanPayment                      InvestmentSubtype = "loan payment"
+	SubtypeLongTermCapitalGain              InvestmentSubtype = "long-term capital gain"
+	SubtypeLongTermCapitalGainReinvestment  InvestmentSubtype = "long-term capital gain reinvestment"
+	SubtypeManagementFee                    InvestmentSubtype = "management fee"
+	SubtypeMarginExpense                    InvestmentSubtype = "margin expense"
+	SubtypeMerger                           InvestmentSubtype = "merger"
+	SubtypeMiscellaneousFee                 InvestmentSubtype = "miscellaneous fee"
+	SubtypeNonQualifiedDividend             InvestmentSubtype = "non-qualified dividend"
+	SubtypeNonResidentTax                   InvestmentSubtype = "non-resident tax"
+	SubtypePendingCredit                    InvestmentSubtype = "pending credit"
+	SubtypePendingDebit                     InvestmentSubtype = "pending debit"
+	SubtypeQualifiedDividend                InvestmentSubtype = "qualified dividend"
+	SubtypeRebalance                        InvestmentSubtype = "rebalance"
+	SubtypeReturnOfPrincipal                InvestmentSubtype = "return of principal"
+	SubtypeRequest                          InvestmentSubtype = "request"
+	SubtypeSell                             InvestmentSubtype = "sell"
+	SubtypeSellShort                        InvestmentSubtype = "sell short"
+	SubtypeSend                             InvestmentSubtype = "send"
+	SubtypeShortTermCapitalGain             InvestmentSubtype = "short-term capital gain"
+	SubtypeShortTermCapitalGainReinvestment InvestmentSubtype = "short-term capital gain reinvestment"
+	SubtypeSpinOff                          InvestmentSubtype = "spin off"
+	SubtypeSplit                            InvestmentSubtype = "split"
+	SubtypeStockDistribution                InvestmentSubtype = "stock distribution"
+	SubtypeTax                              InvestmentSubtype = "tax"
+	SubtypeTaxWithheld                      InvestmentSubtype = "tax withheld"
+	SubtypeTrade                            InvestmentSubtype = "trade"
+	SubtypeTransfer                         InvestmentSubtype = "transfer"
+	SubtypeTransferFee                      InvestmentSubtype = "transfer fee"
+	SubtypeTrustFee                         InvestmentSubtype = "trust fee"
+	SubtypeUnqualifiedGain                  InvestmentSubtype = "unqualified gain"
+	SubtypeWithdrawal                       InvestmentSubtype = "withdrawal"
+)
+
+const (
+	SecurityTypeCash = "cash"
+
+	OptionCall = "call"
+	OptionPut  = "put"
+
+	// shares per option contract, used when a transaction's amount is missing
+	optionMultiplier = 100
+)
+
+// cash subtypes that credit the account, regardless of the sign the
+// institution reports them with
+var creditSubtypes = map[InvestmentSubtype]bool{
+	SubtypeContribution:         true,
+	SubtypeDeposit:              true,
+	SubtypeDividend:             true,
+	SubtypeQualifiedDividend:    true,
+	SubtypeNonQualifiedDividend: true,
+	SubtypeInterest:             true,
+	SubtypeLongTermCapitalGain:  true,
+	SubtypeShortTermCapitalGain: true,
+	SubtypeUnqualifiedGain:      true,
+	SubtypeReturnOfPrincipal:    true,
+	SubtypePendingCredit:        true,
+}
+
+// cash subtypes that debit the account
+var debitSubtypes = map[InvestmentSubtype]bool{
+	SubtypeWithdrawal:       true,
+	SubtypeTax:              true,
+	SubtypeTaxWithheld:      true,
+	SubtypeNonResidentTax:   true,
+	SubtypeLoanPayment:      true,
+	SubtypeAccountFee:       true,
+	SubtypeFundFee:          true,
+	SubtypeLegalFee:         true,
+	SubtypeManagementFee:    true,
+	SubtypeMarginExpense:    true,
+	SubtypeMiscellaneousFee: true,
+	SubtypeTransferFee:      true,
+	SubtypeTrustFee:         true,
+	SubtypePendingDebit:     true,
+}
+
+type investmentOutput int
+
+const (
+	outputNone investmentOutput = iota
+	outputTransactions
+	outputInvestments
+)
+
+// adjustsShares reports whether the transaction changes the number of shares
+// held without a purchase or sale, adjusting existing lots rather than
+// opening or closing them
+func (t InvestmentTransaction) adjustsShares() bool {
+	return t.Subtype == SubtypeSplit || t.Subtype == SubtypeStockDistribution
+}
+
+// closesOption reports whether the transaction closes an option position
+// other than by sale
+func (t InvestmentTransaction) closesOption() bool {
+	switch t.Subtype {
+	case SubtypeExercise, SubtypeAssignment, SubtypeExpire:
+		return true
+	default:
+		return false
+	}
+}
+
+// output returns which output an investment transaction is written to. Cash
+// movements, including transfers of cash rather than securities, are written
+// as transactions and everything else as investments.
+func (t InvestmentTransaction) output(security Security) investmentOutput {
+	switch t.Type {
+	case InvestmentCash, InvestmentFee:
+		if t.Subtype == SubtypeStockDistribution {
+			// the only cash subtype that moves shares rather than currency
+			return outputInvestments
+		}
+		return outputTransactions
+	case InvestmentTransfer:
+		if t.SecurityID == "" || security.Type == SecurityTypeCash {
+			return outputTransactions
+		}
+		return outputInvestments
+	default:
+		return outputInvestments
+	}
+}
+
+// normalize returns the transaction with plaid's sign conventions applied
+// consistently: amounts are positive when cash leaves the account and
+// quantities are positive when shares enter it. Institutions disagree on the
+// signs of sells, dividends and fees. Security transfers move no cash, so
+// their amounts are zeroed, and splits and stock distributions are zero-cost
+// changes in quantity. Subtypes without a clear direction keep the reported
+// sign.
+func (t InvestmentTransaction) normalize(security Security) InvestmentTransaction {
+	if t.adjustsShares() {
+		if t.Subtype == SubtypeStockDistribution {
+			t.Quantity = math.Abs(t.Quantity)
+		}
+		t.Amount = 0
+		t.Price = 0
+		return t
+	}
+
+	switch t.Type {
+	case InvestmentBuy:
+		t.Amount = math.Abs(t.Amount)
+		t.Quantity = math.Abs(t.Quantity)
+	case InvestmentSell:
+		t.Amount = -math.Abs(t.Amount)
+		t.Quantity = -math.Abs(t.Quantity)
+	case InvestmentFee:
+		t.Amount = math.Abs(t.Amount)
+	case InvestmentCash:
+		if creditSubtypes[t.Subtype] {
+			t.Amount = -math.Abs(t.Amount)
+		} else if debitSubtypes[t.Subtype] {
+			t.Amount = math.Abs(t.Amount)
+		}
+	case InvestmentTransfer:
+		if t.SecurityID != "" && security.Type != SecurityTypeCash {
+			t.Amount = 0
+		}
+	}
+	return t
+}
@@ -0,0 +1,426 @@
+package ledger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultJournalIDKey     = "transaction_id"
+	DefaultJournalTolerance = 3 // days
+)
+
+// hledger allows unpadded months and days, which these formats also accept
+var (
+	journalDateFormats         = []string{"2006-1-2", "2006/1/2", "2006.1.2"}
+	journalYearlessDateFormats = []string{"1-2", "1/2", "1.2"}
+)
+
+// JournalEntry is a transaction read from a ledger or hledger journal, or
+// built to be written to one
+type JournalEntry struct {
+	Line     int
+	Date     time.Time
+	Payee    string
+	Pending  bool
+	Metadata map[string]string
+	Postings []JournalPosting
+
+	transferID string // set on entries for one leg of a matched transfer
+}
+
+type JournalPosting struct {
+	Account   string
+	Amount    float64
+	HasAmount bool   // false if the amount was elided and couldn't be inferred
+	Commodity string // only set on written entries
+	Metadata  map[string]string
+
+	// total cost of shares bought, or price of shares sold; only set on
+	// written entries
+	Cost          float64
+	CostCommodity string
+	HasCost       bool
+
+	priced bool // amount is in a commodity other than the entry's cost
+	shares bool // amount is a quantity of shares rather than currency
+}
+
+// ReadJournal parses transactions from a ledger or hledger journal. Directives
+// other than transactions are ignored, as are automated and periodic
+// transactions, except for year directives, which give the year of dates
+// without one. Entries with dates or amounts that can't be read are skipped
+// with a warning. Amounts are read with the dialect's decimal separator,
+// without regard to commodity.
+func ReadJournal(input io.Reader, dialect Dialect) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	var entry *JournalEntry
+	var inComment bool
+	var year int
+
+	finish := func() {
+		if entry != nil {
+			entry.inferAmount()
+			entries = append(entries, *entry)
+			entry = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(input)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if inComment {
+			if strings.HasPrefix(line, "end comment") {
+				inComment = false
+			}
+			continue
+		}
+		if line == "" {
+			finish()
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			finish()
+			if line == "comment" || strings.HasPrefix(line, "comment ") {
+				inComment = true
+				continue
+			}
+			if line[0] < '0' || line[0] > '9' {
+				// directive or top level comment
+				if directiveYear, ok := parseJournalYear(line); ok {
+					year = directiveYear
+				}
+				continue
+			}
+
+			header, err := parseJournalHeader(line, year)
+			if err != nil {
+				log.Printf("Warning: journal line %d: skipping entry: %s\n", lineNumber, err)
+				continue
+			}
+			header.Line = lineNumber
+			entry = header
+			continue
+		}
+
+		if entry == nil {
+			// belongs to a directive or automated transaction
+			continue
+		}
+
+		body := strings.TrimSpace(line)
+		if strings.HasPrefix(body, ";") || strings.HasPrefix(body, "#") {
+			metadata := entry.Metadata
+			if len(entry.Postings) > 0 {
+				metadata = entry.Postings[len(entry.Postings)-1].Metadata
+			}
+			parseJournalMetadata(body[1:], metadata)
+			continue
+		}
+
+		posting, err := parseJournalPosting(body, dialect)
+		if err != nil {
+			log.Printf("Warning: journal line %d: skipping entry: %s\n", lineNumber, err)
+			entry = nil
+			continue
+		}
+		entry.Postings = append(entry.Postings, posting)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan journal: %w", err)
+	}
+	finish()
+
+	return entries, nil
+}
+
+// parseJournalYear reads the year from a "Y", "year" or "apply year"
+// directive
+func parseJournalYear(line string) (int, bool) {
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 1 && strings.HasPrefix(fields[0], "Y"):
+		fields = []string{"Y", fields[0][1:]}
+	case len(fields) == 3 && fields[0] == "apply" && fields[1] == "year":
+		fields = fields[1:]
+	}
+	if len(fields) != 2 || (fields[0] != "Y" && fields[0] != "year") {
+		return 0, false
+	}
+
+	year, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, false
+	}
+	return year, true
+}
+
+// parseJournalHeader reads an entry's date, payee and metadata. Dates without
+// a year are given year, if it isn't zero.
+func parseJournalHeader(line string, year int) (*JournalEntry, error) {
+	entry := &JournalEntry{Metadata: make(map[string]string)}
+
+	if i := strings.Index(line, ";"); i >= 0 {
+		parseJournalMetadata(line[i+1:], entry.Metadata)
+		line = line[:i]
+	}
+
+	date, rest, _ := strings.Cut(line, " ")
+	date, _, _ = strings.Cut(date, "=") // ignore secondary dates
+	var parsed bool
+	for _, format := range journalDateFormats {
+		if t, err := time.Parse(format, date); err == nil {
+			entry.Date, parsed = t, true
+			break
+		}
+	}
+	if !parsed && year != 0 {
+		for _, format := range journalYearlessDateFormats {
+			if t, err := time.Parse(format, date); err == nil {
+				entry.Date, parsed = t.AddDate(year-t.Year(), 0, 0), true
+				break
+			}
+		}
+	}
+	if !parsed {
+		return nil, fmt.Errorf("parse date %q", date)
+	}
+
+	rest = strings.TrimSpace(rest)
+	rest = strings.TrimSpace(strings.TrimLeft(rest, "*!"))
+	if strings.HasPrefix(rest, "(") {
+		if i := strings.Index(rest, ")"); i >= 0 {
+			rest = strings.TrimSpace(rest[i+1:])
+		}
+	}
+	entry.Payee = rest
+
+	return entry, nil
+}
+
+// parseJournalPosting reads a posting's account, amount and metadata. Amounts
+// are read with the dialect's decimal and grouping separators.
+func parseJournalPosting(line string, dialect Dialect) (JournalPosting, error) {
+	posting := JournalPosting{Metadata: make(map[string]string)}
+
+	if i := strings.Index(line, ";"); i >= 0 {
+		parseJournalMetadata(line[i+1:], posting.Metadata)
+		line = strings.TrimSpace(line[:i])
+	}
+	line = strings.TrimSpace(strings.TrimLeft(line, "*!"))
+
+	// accounts may contain single spaces, so they end at two spaces or a tab
+	end := len(line)
+	if i := strings.Index(line, "  "); i >= 0 {
+		end = i
+	}
+	if i := strings.Index(line, "\t"); i >= 0 && i < end {
+		end = i
+	}
+	account, amount := line[:end], line[end:]
+	posting.Account = strings.Trim(strings.TrimSpace(account), "()[]")
+
+	// drop prices and balance assertions
+	amount, _, posting.priced = strings.Cut(amount, "@")
+	amount, _, _ = strings.Cut(amount, "=")
+
+	// drop lot costs, like prices, and lot dates
+	if stripped, ok := stripJournalAnnotations(amount, '{', '}'); ok {
+		amount = stripped
+		posting.priced = true
+	}
+	amount, _ = stripJournalAnnotations(amount, '[', ']')
+	// quoted commodities may contain digits
+	amount, _ = stripJournalAnnotations(amount, '"', '"')
+
+	value, ok, err := dialect.parseAmount(amount)
+	if err != nil {
+		return posting, err
+	}
+	posting.Amount, posting.HasAmount = value, ok
+
+	return posting, nil
+}
+
+// stripJournalAnnotations removes text between open and close, inclusive,
+// such as "{10 USD}" or "{{100 USD}}", reporting whether any was removed
+func stripJournalAnnotations(amount string, open, close byte) (string, bool) {
+	var stripped bool
+	for {
+		start := strings.IndexByte(amount, open)
+		if start < 0 {
+			return amount, stripped
+		}
+		end := strings.IndexByte(amount[start+1:], close)
+		if end < 0 {
+			return amount, stripped
+		}
+		end += start + 1
+
+		// doubled braces close with doubled braces
+		for end+1 < len(amount) && amount[end+1] == close {
+			end += 1
+		}
+		amount = amount[:start] + " " + amount[end+1:]
+		stripped = true
+	}
+}
+
+// parseJournalMetadata reads "key: value" metadata from a comment, ignoring
+// plain comments and ":tag:" tags. Multiple values may be separated by
+// commas, as in hledger.
+func parseJournalMetadata(comment string, metadata map[string]string) {
+	for _, part := range strings.Split(comment, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			continue
+		}
+		metadata[key] = strings.TrimSpace(value)
+	}
+}
+
+// inferAmount fills in a single elided posting amount, which balances the
+// entry. Entries with priced postings are left alone, as their amounts are
+// in different commodities.
+func (e *JournalEntry) inferAmount() {
+	elided := -1
+	var sum float64
+	for i, posting := range e.Postings {
+		if posting.priced {
+			return
+		}
+		if !posting.HasAmount {
+			if elided >= 0 {
+				return
+			}
+			elided = i
+			continue
+		}
+		sum += posting.Amount
+	}
+	if elided >= 0 {
+		e.Postings[elided].Amount = -sum
+		e.Postings[elided].HasAmount = true
+	}
+}
+
+type journalPosting struct {
+	date    time.Time
+	account string
+	amount  float64
+	used    bool
+}
+
+// JournalMatcher finds activity already recorded in journals, either by
+// transaction ID in metadata or, for postings without IDs, by account, amount
+// and date
+type JournalMatcher struct {
+	ids       map[string]bool
+	postings  []*journalPosting
+	tolerance int
+}
+
+func NewJournalMatcher(entries []JournalEntry, idKey string, tolerance int) *JournalMatcher {
+	m := &JournalMatcher{
+		ids:       make(map[string]bool),
+		tolerance: tolerance,
+	}
+
+	for _, entry := range entries {
+		entryID := entry.Metadata[idKey]
+		if entryID != "" {
+			m.ids[entryID] = true
+		}
+
+		for _, posting := range entry.Postings {
+			if id := posting.Metadata[idKey]; id != "" {
+				m.ids[id] = true
+				continue
+			}
+			if entryID != "" || !posting.HasAmount {
+				continue
+			}
+
+			m.postings = append(m.postings, &journalPosting{
+				date:    entry.Date,
+				account: posting.Account,
+				amount:  posting.Amount,
+			})
+		}
+	}
+
+	return m
+}
+
+// recorded reports whether a transaction is in the journal. Journals record
+// outflows as negative postings, the opposite of plaid. Postings matched
+// without an ID are only matched once.
+func (m *JournalMatcher) recorded(id, account string, amount float64, dates ...Date) bool {
+	if m.ids[id] {
+		return true
+	}
+
+	for _, posting := range m.postings {
+		if posting.used || posting.account != account || math.Abs(posting.amount+amount) > 0.005 {
+			continue
+		}
+		for _, date := range dates {
+			if !date.Time.IsZero() && daysBetween(posting.date, date.Time) <= m.tolerance {
+				posting.used = true
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Filter removes transactions and investments already in the journal from
+// item, returning the number removed. Investments are only matched by ID.
+func (m *JournalMatcher) Filter(itemConfig *ItemConfig, item *ItemData) int {
+	var count int
+
+	var transactions []Transaction
+	for _, transaction := range item.Transactions {
+		account := itemConfig.Transactions[transaction.AccountID]
+		if m.recorded(transaction.ID, account, transaction.Amount, transaction.Date, transaction.AuthorizedDate) {
+			count += 1
+			continue
+		}
+		transactions = append(transactions, transaction)
+	}
+	item.Transactions = transactions
+
+	var investments []InvestmentTransaction
+	for _, investment := range item.Investments {
+		if m.ids[investment.ID] {
+			count += 1
+			continue
+		}
+		investments = append(investments, investment)
+	}
+	item.Investments = investments
+
+	return count
+}
+
+// daysBetween counts calendar days between dates, ignoring time zones
+func daysBetween(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(a.Sub(b).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
@@ -0,0 +1,602 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type LotMethod string
+
+const (
+	LotMethodFIFO       LotMethod = "fifo"
+	LotMethodLIFO       LotMethod = "lifo"
+	LotMethodSpecificID LotMethod = "specific-id"
+	LotMethodAverage    LotMethod = "average"
+
+	DefaultLotMethod = LotMethodFIFO
+
+	quantityEpsilon = 1e-9
+)
+
+type Term string
+
+const (
+	ShortTerm   Term = "short"
+	LongTerm    Term = "long"
+	UnknownTerm Term = "unknown" // sold without a matching lot
+)
+
+func ParseLotMethod(method string) (LotMethod, error) {
+	switch m := LotMethod(method); m {
+	case LotMethodFIFO, LotMethodLIFO, LotMethodSpecificID, LotMethodAverage:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown lot method: %q", method)
+	}
+}
+
+type Lot struct {
+	ID         string // ID of the transaction that opened the lot
+	AccountID  string
+	SecurityID string
+	Acquired   time.Time
+	Quantity   float64
+	CostBasis  float64
+	washed     bool // replacement shares of a wash sale, which can't replace another
+}
+
+type RealizedGain struct {
+	SaleID       string
+	LotID        string // empty if no lot matched the sale
+	AccountID    string
+	SecurityID   string
+	Acquired     time.Time
+	Sold         time.Time
+	Quantity     float64
+	Proceeds     float64
+	CostBasis    float64
+	MissingBasis bool    // no lot matched the sale, so CostBasis is unknown rather than zero
+	WashSale     float64 // loss disallowed by a wash sale and added to the replacement shares' basis
+	Term         Term
+}
+
+func (g RealizedGain) Gain() float64 {
+	return g.Proceeds - g.CostBasis
+}
+
+type lotKey struct {
+	accountID  string
+	securityID string
+}
+
+// washSale is a loss sale whose replacement shares haven't all been found
+type washSale struct {
+	gain     int     // index of the loss in gains
+	quantity float64 // shares of the loss not yet replaced
+}
+
+// TrackLots replays an item's investment history in date order, opening a lot
+// for each buy and closing lots against each sell using the given method. A
+// sale that spans several lots produces one RealizedGain per lot. Splits and
+// stock distributions adjust the quantity of open lots.
+//
+// Expired options are closed at a loss of their cost basis. The basis of
+// exercised options is carried to the underlying: added to the cost of shares
+// bought by a call, or deducted from the proceeds of shares sold by a put.
+// Options sold beyond those held are written, opening a short position with
+// the premium received. Buying them back or letting them expire realizes a
+// short-term gain of the premium less the cost to close. The premium of
+// assigned options is carried to the underlying: added to the proceeds of
+// shares sold by a call, or deducted from the cost of shares bought by a put.
+//
+// A loss is a wash sale when shares of the same security, in any account,
+// are bought within 30 days before or after the sale. The disallowed loss is
+// added to the basis of the replacement shares, whose holding period is
+// extended by that of the shares sold. Shares are split off their lot to
+// replace a loss, and replace at most one loss.
+func TrackLots(itemConfig *ItemConfig, item *ItemData, method LotMethod) ([]RealizedGain, error) {
+	history := make([]InvestmentTransaction, len(item.Investments))
+	for i, transaction := range item.Investments {
+		history[i] = transaction.normalize(item.Securities[transaction.SecurityID])
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		if !history[i].Date.Time.Equal(history[j].Date.Time) {
+			return history[i].Date.Time.Before(history[j].Date.Time)
+		}
+		// close options, then open and adjust same-day lots before closing them
+		return lotOrder(history[i], item.Securities) < lotOrder(history[j], item.Securities)
+	})
+
+	underlyings := make(map[string]string)
+	for id, security := range item.Securities {
+		if security.TickerSymbol != "" && security.OptionContract == nil {
+			underlyings[security.TickerSymbol] = id
+		}
+	}
+
+	lots := make(map[lotKey][]*Lot)
+	shorts := make(map[lotKey][]*Lot)    // written options, with their premium as basis
+	buyCost := make(map[lotKey]float64)  // added to the cost of the next buy
+	sellCost := make(map[lotKey]float64) // deducted from the proceeds of the next sell
+	var gains []RealizedGain
+	var washes []washSale
+	for _, transaction := range history {
+		key := lotKey{transaction.AccountID, transaction.SecurityID}
+		quantity := math.Abs(transaction.Quantity)
+		if quantity < quantityEpsilon {
+			continue
+		}
+
+		if transaction.adjustsShares() {
+			lots[key] = adjustLots(lots[key], transaction)
+			continue
+		}
+
+		security := item.Securities[transaction.SecurityID]
+		multiplier := 1.0
+		if security.OptionContract != nil {
+			multiplier = optionMultiplier
+		}
+
+		if security.OptionContract != nil && transaction.closesOption() {
+			// options held are closed before written options
+			var sold []RealizedGain
+			held := math.Min(quantity, heldQuantity(lots[key]))
+			if held >= quantityEpsilon {
+				closed, kept, err := closeLots(lots[key], transaction, held, 0, method, itemConfig.Lots[transaction.ID])
+				if err != nil {
+					return nil, fmt.Errorf("select lots for option %q: %w", transaction.ID, err)
+				}
+				lots[key] = kept
+				sold = closed
+			}
+			written, kept := closeShorts(shorts[key], transaction, quantity-held, 0)
+			shorts[key] = kept
+
+			if transaction.Subtype == SubtypeExpire {
+				gains = append(append(gains, sold...), written...)
+				continue
+			}
+
+			underlying, ok := underlyings[security.OptionContract.UnderlyingSecurityTicker]
+			if !ok {
+				continue
+			}
+			var basis, premium float64
+			for _, gain := range sold {
+				basis += gain.CostBasis
+			}
+			for _, gain := range written {
+				premium += gain.Proceeds
+			}
+
+			// exercised calls and assigned puts buy the underlying, and
+			// exercised puts and assigned calls sell it
+			underlyingKey := lotKey{transaction.AccountID, underlying}
+			switch strings.ToLower(security.OptionContract.ContractType) {
+			case OptionCall:
+				buyCost[underlyingKey] += basis
+				sellCost[underlyingKey] -= premium
+			case OptionPut:
+				sellCost[underlyingKey] += basis
+				buyCost[underlyingKey] -= premium
+			}
+			continue
+		}
+
+		switch transaction.Type {
+		case InvestmentBuy:
+			cost := math.Abs(transaction.Amount)
+			if cost == 0 {
+				cost = quantity*transaction.Price*multiplier + transaction.Fees
+			}
+			cost += buyCost[key]
+			delete(buyCost, key)
+
+			// buying back written options closes them first
+			if covered := math.Min(quantity, heldQuantity(shorts[key])); covered >= quantityEpsilon {
+				coverCost := cost * covered / quantity
+				closed, kept := closeShorts(shorts[key], transaction, covered, coverCost)
+				shorts[key] = kept
+				gains = append(gains, closed...)
+
+				cost -= coverCost
+				quantity -= covered
+				if quantity < quantityEpsilon {
+					continue
+				}
+			}
+
+			bought := &Lot{
+				ID:         transaction.ID,
+				AccountID:  transaction.AccountID,
+				SecurityID: transaction.SecurityID,
+				Acquired:   transaction.Date.Time,
+				Quantity:   quantity,
+				CostBasis:  cost,
+			}
+			lots[key] = append(lots[key], bought)
+
+			// earlier losses replaced by this buy
+			var pending []washSale
+			for _, wash := range washes {
+				gain := &gains[wash.gain]
+				if transaction.Date.Time.After(gain.Sold.AddDate(0, 0, washSaleWindow)) {
+					continue
+				}
+				if gain.SecurityID == transaction.SecurityID {
+					lots[key] = replaceLots(lots[key], &wash, gain, func(lot *Lot) bool {
+						return lot == bought
+					})
+				}
+				if wash.quantity >= quantityEpsilon {
+					pending = append(pending, wash)
+				}
+			}
+			washes = pending
+		case InvestmentSell:
+			proceeds := math.Abs(transaction.Amount)
+			if proceeds == 0 {
+				proceeds = quantity*transaction.Price*multiplier - transaction.Fees
+			}
+			proceeds -= sellCost[key]
+			delete(sellCost, key)
+
+			// selling options beyond those held writes them
+			if security.OptionContract != nil {
+				if written := quantity - heldQuantity(lots[key]); written >= quantityEpsilon {
+					premium := proceeds * written / quantity
+					shorts[key] = append(shorts[key], &Lot{
+						ID:         transaction.ID,
+						AccountID:  transaction.AccountID,
+						SecurityID: transaction.SecurityID,
+						Acquired:   transaction.Date.Time,
+						Quantity:   written,
+						CostBasis:  premium,
+					})
+
+					proceeds -= premium
+					quantity -= written
+					if quantity < quantityEpsilon {
+						continue
+					}
+				}
+			}
+
+			sold, kept, err := closeLots(lots[key], transaction, quantity, proceeds, method, itemConfig.Lots[transaction.ID])
+			if err != nil {
+				return nil, fmt.Errorf("select lots for sale %q: %w", transaction.ID, err)
+			}
+			lots[key] = kept
+
+			closed := make(map[string]bool)
+			for _, gain := range sold {
+				closed[gain.LotID] = true
+			}
+			windowStart := transaction.Date.Time.AddDate(0, 0, -washSaleWindow)
+			replaceable := func(lot *Lot) bool {
+				return !closed[lot.ID] && !lot.Acquired.Before(windowStart)
+			}
+
+			// shares of the same security held in any account
+			var keys []lotKey
+			for held := range lots {
+				if held.securityID == transaction.SecurityID {
+					keys = append(keys, held)
+				}
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].accountID < keys[j].accountID
+			})
+
+			for _, gain := range sold {
+				gains = append(gains, gain)
+				if gain.MissingBasis || gain.Gain() >= 0 {
+					continue
+				}
+
+				// losses replaced by shares bought in the 30 days before the
+				// sale, or else by later buys
+				wash := washSale{gain: len(gains) - 1, quantity: gain.Quantity}
+				for _, held := range keys {
+					lots[held] = replaceLots(lots[held], &wash, &gains[wash.gain], replaceable)
+				}
+				if wash.quantity >= quantityEpsilon {
+					washes = append(washes, wash)
+				}
+			}
+		}
+	}
+
+	return gains, nil
+}
+
+// replaceLots adds the disallowed loss of a wash sale to the replaceable open
+// lots in order, until the loss's shares are all replaced. Replacement shares
+// are split off into their own lot ahead of the rest of the lot, so that lot
+// order is kept.
+func replaceLots(open []*Lot, wash *washSale, gain *RealizedGain, replaceable func(*Lot) bool) []*Lot {
+	var kept []*Lot
+	for _, lot := range open {
+		if wash.quantity < quantityEpsilon || lot.washed || !replaceable(lot) {
+			kept = append(kept, lot)
+			continue
+		}
+
+		portion := math.Min(lot.Quantity, wash.quantity)
+		basis := lot.CostBasis * portion / lot.Quantity
+		loss := -gain.Gain() * portion / gain.Quantity
+		kept = append(kept, &Lot{
+			ID:         lot.ID,
+			AccountID:  lot.AccountID,
+			SecurityID: lot.SecurityID,
+			Acquired:   lot.Acquired.Add(-gain.Sold.Sub(gain.Acquired)),
+			Quantity:   portion,
+			CostBasis:  basis + loss,
+			washed:     true,
+		})
+
+		lot.Quantity -= portion
+		lot.CostBasis -= basis
+		if lot.Quantity >= quantityEpsilon {
+			kept = append(kept, lot)
+		}
+		gain.WashSale += loss
+		wash.quantity -= portion
+	}
+	return kept
+}
+
+// WithHistory returns a copy of the item whose investments also include those
+// from earlier history of the same item, so that lots bought before the item's
+// activity can be tracked. Investments are deduplicated by ID, preferring the
+// item's own, and securities are merged.
+func (i *ItemData) WithHistory(history []*ItemData) *ItemData {
+	merged := *i
+	merged.Investments = nil
+	merged.Securities = make(map[string]Security, len(i.Securities))
+
+	seen := make(map[string]bool)
+	for _, investment := range i.Investments {
+		seen[investment.ID] = true
+	}
+	for _, past := range history {
+		if past.ID != i.ID {
+			continue
+		}
+		for _, investment := range past.Investments {
+			if !seen[investment.ID] {
+				seen[investment.ID] = true
+				merged.Investments = append(merged.Investments, investment)
+			}
+		}
+		for id, security := range past.Securities {
+			merged.Securities[id] = security
+		}
+	}
+	merged.Investments = append(merged.Investments, i.Investments...)
+	for id, security := range i.Securities {
+		merged.Securities[id] = security
+	}
+
+	return &merged
+}
+
+// closeLots closes quantity shares of open lots against a sale, returning the
+// realized gains and the lots left open. Shares sold beyond the open lots,
+// typically bought before the history lots were tracked from, are realized
+// with a missing basis.
+func closeLots(open []*Lot, transaction InvestmentTransaction, quantity, proceeds float64, method LotMethod, selected []string) ([]RealizedGain, []*Lot, error) {
+	ordered, err := orderLots(open, method, selected)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var gains []RealizedGain
+	remaining := quantity
+	for _, lot := range ordered {
+		if remaining < quantityEpsilon {
+			break
+		}
+
+		portion := math.Min(lot.Quantity, remaining)
+		basis := lot.CostBasis * portion / lot.Quantity
+		gains = append(gains, RealizedGain{
+			SaleID:     transaction.ID,
+			LotID:      lot.ID,
+			AccountID:  transaction.AccountID,
+			SecurityID: transaction.SecurityID,
+			Acquired:   lot.Acquired,
+			Sold:       transaction.Date.Time,
+			Quantity:   portion,
+			Proceeds:   proceeds * portion / quantity,
+			CostBasis:  basis,
+			Term:       holdingTerm(lot.Acquired, transaction.Date.Time),
+		})
+
+		lot.Quantity -= portion
+		lot.CostBasis -= basis
+		remaining -= portion
+	}
+
+	if remaining >= quantityEpsilon {
+		gains = append(gains, RealizedGain{
+			SaleID:       transaction.ID,
+			AccountID:    transaction.AccountID,
+			SecurityID:   transaction.SecurityID,
+			Sold:         transaction.Date.Time,
+			Quantity:     remaining,
+			Proceeds:     proceeds * remaining / quantity,
+			MissingBasis: true,
+			Term:         UnknownTerm,
+		})
+	}
+
+	// averaged lots are copies, which replace the originals
+	if method == LotMethodAverage {
+		open = ordered
+	}
+	var kept []*Lot
+	for _, lot := range open {
+		if lot.Quantity >= quantityEpsilon {
+			kept = append(kept, lot)
+		}
+	}
+
+	return gains, kept, nil
+}
+
+// closeShorts closes quantity of written options in FIFO order at a total
+// cost, returning the realized gains and the positions left open. Gains on
+// written options are short-term however long they were open. Options closed
+// beyond those written are ignored.
+func closeShorts(open []*Lot, transaction InvestmentTransaction, quantity, cost float64) ([]RealizedGain, []*Lot) {
+	var gains []RealizedGain
+	remaining := quantity
+	for _, lot := range open {
+		if remaining < quantityEpsilon {
+			break
+		}
+
+		portion := math.Min(lot.Quantity, remaining)
+		premium := lot.CostBasis * portion / lot.Quantity
+		gains = append(gains, RealizedGain{
+			SaleID:     transaction.ID,
+			LotID:      lot.ID,
+			AccountID:  transaction.AccountID,
+			SecurityID: transaction.SecurityID,
+			Acquired:   lot.Acquired,
+			Sold:       transaction.Date.Time,
+			Quantity:   portion,
+			Proceeds:   premium,
+			CostBasis:  cost * portion / quantity,
+			Term:       ShortTerm,
+		})
+
+		lot.Quantity -= portion
+		lot.CostBasis -= premium
+		remaining -= portion
+	}
+
+	var kept []*Lot
+	for _, lot := range open {
+		if lot.Quantity >= quantityEpsilon {
+			kept = append(kept, lot)
+		}
+	}
+
+	return gains, kept
+}
+
+// heldQuantity sums the quantity of open lots
+func heldQuantity(open []*Lot) float64 {
+	var held float64
+	for _, lot := range open {
+		held += lot.Quantity
+	}
+	return held
+}
+
+func lotOrder(transaction InvestmentTransaction, securities map[string]Security) int {
+	switch {
+	case transaction.closesOption() && securities[transaction.SecurityID].OptionContract != nil:
+		return 0
+	case transaction.Type == InvestmentBuy:
+		return 1
+	case transaction.adjustsShares():
+		return 2
+	default:
+		return 3
+	}
+}
+
+// adjustLots applies a split, reverse split or stock distribution to open
+// lots. The change in quantity is spread across lots in proportion to their
+// size, keeping each lot's cost basis and acquisition date, as distributed
+// shares inherit both from the shares they were distributed on. Without open
+// lots, typically because the shares were bought before the history lots were
+// tracked from, nothing is adjusted, and sales of the shares are realized
+// with a missing basis.
+func adjustLots(open []*Lot, transaction InvestmentTransaction) []*Lot {
+	held := heldQuantity(open)
+	if held < quantityEpsilon {
+		return open
+	}
+
+	ratio := (held + transaction.Quantity) / held
+	if ratio < 0 {
+		ratio = 0
+	}
+
+	var kept []*Lot
+	for _, lot := range open {
+		lot.Quantity *= ratio
+		if lot.Quantity >= quantityEpsilon {
+			kept = append(kept, lot)
+		}
+	}
+	return kept
+}
+
+// orderLots returns open lots in the order they should be consumed. Lots
+// named by a specific-ID selection come first, followed by the remaining lots
+// in FIFO order. Average cost lots are returned as copies in FIFO order, each
+// with the average basis of all open lots, leaving open unchanged.
+func orderLots(open []*Lot, method LotMethod, selected []string) ([]*Lot, error) {
+	ordered := make([]*Lot, 0, len(open))
+	switch method {
+	case LotMethodFIFO:
+		ordered = append(ordered, open...)
+	case LotMethodLIFO:
+		for i := len(open) - 1; i >= 0; i-- {
+			ordered = append(ordered, open[i])
+		}
+	case LotMethodSpecificID:
+		used := make(map[*Lot]bool)
+		for _, id := range selected {
+			var found bool
+			for _, lot := range open {
+				if lot.ID == id && !used[lot] {
+					ordered = append(ordered, lot)
+					used[lot] = true
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown or closed lot: %q", id)
+			}
+		}
+		for _, lot := range open {
+			if !used[lot] {
+				ordered = append(ordered, lot)
+			}
+		}
+	case LotMethodAverage:
+		var quantity, basis float64
+		for _, lot := range open {
+			quantity += lot.Quantity
+			basis += lot.CostBasis
+		}
+		for _, lot := range open {
+			averaged := *lot
+			averaged.CostBasis = basis * lot.Quantity / quantity
+			ordered = append(ordered, &averaged)
+		}
+	default:
+		return nil, fmt.Errorf("unknown lot method: %q", method)
+	}
+
+	return ordered, nil
+}
+
+// holdingTerm classifies a holding period as long-term if the sale falls more
+// than one year after acquisition
+func holdingTerm(acquired, sold time.Time) Term {
+	if sold.After(acquired.AddDate(1, 0, 0)) {
+		return LongTerm
+	}
+	return ShortTerm
+}
@@ -0,0 +1,166 @@
+package ledger
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type PayeeField string
+
+const (
+	PayeeName                PayeeField = "name"
+	PayeeMerchantName        PayeeField = "merchant_name"
+	PayeeOriginalDescription PayeeField = "original_description"
+	PayeePaymentMetaPayee    PayeeField = "payment_meta.payee"
+)
+
+type PayeeNormalizer string
+
+const (
+	NormalizeStripPrefixes    PayeeNormalizer = "strip-prefixes"
+	NormalizeTrimStoreNumbers PayeeNormalizer = "trim-store-numbers"
+	NormalizeTitleCase        PayeeNormalizer = "title-case"
+)
+
+// DefaultPayeeFields prefers plaid's cleaned up name over the merchant name
+var DefaultPayeeFields = []PayeeField{PayeeName, PayeeMerchantName}
+
+// DefaultPayeePrefixes are card and ACH processing prefixes removed by the
+// strip-prefixes normalizer
+var DefaultPayeePrefixes = []string{
+	"POS DEBIT",
+	"POS PURCHASE",
+	"POS WITHDRAWAL",
+	"DEBIT CARD PURCHASE",
+	"CHECKCARD",
+	"ACH DEBIT",
+	"ACH CREDIT",
+	"SQ *",
+	"TST*",
+}
+
+// MemoColumns may be appended to a transactions layout to include the
+// description as it appeared on the statement
+var MemoColumns = []ColumnConfig{
+	{Name: "Memo", Template: "{{.OriginalDescription}}"},
+}
+
+var (
+	storeNumberPattern    = regexp.MustCompile(`(?i)\s*(\bstore\s*)?#\s*\d+`)
+	trailingNumberPattern = regexp.MustCompile(`\s+\d{3,}$`)
+)
+
+type PayeeConfig struct {
+	Fields    []PayeeField      `yaml:"fields"`    // first non-empty field is used
+	Normalize []PayeeNormalizer `yaml:"normalize"` // applied in order
+	Prefixes  []string          `yaml:"prefixes"`  // stripped in addition to DefaultPayeePrefixes
+}
+
+// Payee derives a payee from a transaction
+type Payee struct {
+	fields      []PayeeField
+	normalizers []PayeeNormalizer
+	prefixes    []string
+}
+
+func NewPayee(config PayeeConfig) (*Payee, error) {
+	payee := &Payee{
+		fields:      config.Fields,
+		normalizers: config.Normalize,
+	}
+	if len(payee.fields) == 0 {
+		payee.fields = DefaultPayeeFields
+	}
+
+	for _, field := range payee.fields {
+		switch field {
+		case PayeeName, PayeeMerchantName, PayeeOriginalDescription, PayeePaymentMetaPayee:
+		default:
+			return nil, fmt.Errorf("unknown payee field: %q", field)
+		}
+	}
+	for _, normalizer := range payee.normalizers {
+		switch normalizer {
+		case NormalizeStripPrefixes, NormalizeTrimStoreNumbers, NormalizeTitleCase:
+		default:
+			return nil, fmt.Errorf("unknown payee normalizer: %q", normalizer)
+		}
+	}
+
+	// strip longer prefixes first so that e.g. "POS DEBIT" isn't left as
+	// "DEBIT" by a shorter "POS" prefix
+	payee.prefixes = append(append([]string{}, DefaultPayeePrefixes...), config.Prefixes...)
+	sort.SliceStable(payee.prefixes, func(i, j int) bool {
+		return len(payee.prefixes[i]) > len(payee.prefixes[j])
+	})
+
+	return payee, nil
+}
+
+// defaultPayee derives payees from DefaultPayeeFields without normalization,
+// which unlike NewPayee can't fail
+func defaultPayee() *Payee {
+	return &Payee{fields: DefaultPayeeFields}
+}
+
+// Derive returns the first non-empty payee field, normalized
+func (p *Payee) Derive(transaction Transaction) string {
+	var payee string
+	for _, field := range p.fields {
+		switch field {
+		case PayeeName:
+			payee = transaction.Name
+		case PayeeMerchantName:
+			payee = transaction.MerchantName
+		case PayeeOriginalDescription:
+			payee = transaction.OriginalDescription
+		case PayeePaymentMetaPayee:
+			payee = transaction.PaymentMeta.Payee
+		}
+		if payee != "" {
+			break
+		}
+	}
+
+	for _, normalizer := range p.normalizers {
+		switch normalizer {
+		case NormalizeStripPrefixes:
+			payee = p.stripPrefixes(payee)
+		case NormalizeTrimStoreNumbers:
+			payee = storeNumberPattern.ReplaceAllString(payee, "")
+			payee = trailingNumberPattern.ReplaceAllString(payee, "")
+		case NormalizeTitleCase:
+			payee = titleCase(payee)
+		}
+		payee = strings.TrimSpace(payee)
+	}
+
+	return payee
+}
+
+func (p *Payee) stripPrefixes(payee string) string {
+	for stripped := true; stripped; {
+		stripped = false
+		for _, prefix := range p.prefixes {
+			if len(payee) >= len(prefix) && strings.EqualFold(payee[:len(prefix)], prefix) {
+				payee = strings.TrimLeft(payee[len(prefix):], " -:")
+				stripped = true
+				break
+			}
+		}
+	}
+	return payee
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(first)) + strings.ToLower(word[size:])
+	}
+	return strings.Join(words, " ")
+}
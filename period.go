@@ -0,0 +1,171 @@
+package ledger
+
+import (
+	"fmt"
+	"time"
+)
+
+// Period is a named range of dates relative to the current date
+type Period string
+
+const (
+	PeriodLastMonth      Period = "last-month"
+	PeriodThisMonth      Period = "this-month"
+	PeriodLastSemimonth  Period = "last-semimonth"
+	PeriodQuarter        Period = "quarter"
+	PeriodLastQuarter    Period = "last-quarter"
+	PeriodYearToDate     Period = "ytd"
+	PeriodLastYear       Period = "last-year"
+	PeriodFiscalYear     Period = "fiscal-year"
+	PeriodLastFiscalYear Period = "last-fiscal-year"
+
+	// transactions authorized near the end of a period may not post until
+	// after it, so they're requested for this many days past its end
+	DefaultSettlementDays = 5
+)
+
+func ParsePeriod(name string) (Period, error) {
+	switch period := Period(name); period {
+	case PeriodLastMonth, PeriodThisMonth, PeriodLastSemimonth,
+		PeriodQuarter, PeriodLastQuarter,
+		PeriodYearToDate, PeriodLastYear,
+		PeriodFiscalYear, PeriodLastFiscalYear:
+		return period, nil
+	default:
+		return "", fmt.Errorf("unknown period: %q", name)
+	}
+}
+
+// Window is a range of dates to request from plaid and the range records are
+// clamped to once received
+type Window struct {
+	FetchStart time.Time // inclusive
+	FetchEnd   time.Time // inclusive
+	Start      time.Time // inclusive
+	End        time.Time // exclusive; records aren't clamped if zero
+}
+
+// SemimonthlyWindow requests records from start to end, clamping them to the
+// last semimonthly boundary on or before end: the 15th or the last day of the
+// month
+func SemimonthlyWindow(start, end time.Time) Window {
+	boundary := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, end.Location())
+	if end.Day() >= 15 {
+		boundary = time.Date(end.Year(), end.Month(), 16, 0, 0, 0, 0, end.Location())
+	}
+
+	return Window{
+		FetchStart: start,
+		FetchEnd:   end,
+		Start:      start,
+		End:        boundary,
+	}
+}
+
+// Window returns the window for the period relative to now. Periods ending
+// before now are requested for settlementDays past their end, up to now.
+// Fiscal years begin on the first of fiscalYearStart, or January if zero.
+func (p Period) Window(now time.Time, fiscalYearStart time.Month, settlementDays int) (Window, error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	tomorrow := today.AddDate(0, 0, 1)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	quarter := time.Date(now.Year(), (now.Month()-1)/3*3+1, 1, 0, 0, 0, 0, loc)
+	year := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, loc)
+
+	if fiscalYearStart == 0 {
+		fiscalYearStart = time.January
+	}
+	fiscalYear := time.Date(now.Year(), fiscalYearStart, 1, 0, 0, 0, 0, loc)
+	if now.Month() < fiscalYearStart {
+		fiscalYear = fiscalYear.AddDate(-1, 0, 0)
+	}
+
+	var start, end time.Time
+	switch p {
+	case PeriodLastMonth:
+		start, end = month.AddDate(0, -1, 0), month
+	case PeriodThisMonth:
+		start, end = month, tomorrow
+	case PeriodLastSemimonth:
+		if now.Day() > 15 {
+			start, end = month, month.AddDate(0, 0, 15)
+		} else {
+			start, end = month.AddDate(0, -1, 15), month
+		}
+	case PeriodQuarter:
+		start, end = quarter, tomorrow
+	case PeriodLastQuarter:
+		start, end = quarter.AddDate(0, -3, 0), quarter
+	case PeriodYearToDate:
+		start, end = year, tomorrow
+	case PeriodLastYear:
+		start, end = year.AddDate(-1, 0, 0), year
+	case PeriodFiscalYear:
+		start, end = fiscalYear, tomorrow
+	case PeriodLastFiscalYear:
+		start, end = fiscalYear.AddDate(-1, 0, 0), fiscalYear
+	default:
+		return Window{}, fmt.Errorf("unknown period: %q", p)
+	}
+
+	fetchEnd := end.AddDate(0, 0, settlementDays-1)
+	if fetchEnd.After(today) {
+		fetchEnd = today
+	}
+
+	return Window{
+		FetchStart: start,
+		FetchEnd:   fetchEnd,
+		Start:      start,
+		End:        end,
+	}, nil
+}
+
+func (w Window) contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Clamp removes transactions and investments outside the window from item.
+// Transactions are clamped by authorized date where available, as posting
+// may be delayed past the end of the window.
+func (w Window) Clamp(item *ItemData) {
+	if w.End.IsZero() {
+		return
+	}
+
+	var transactions []Transaction
+	for _, transaction := range item.Transactions {
+		if w.contains(TransactionDate(transaction)) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	item.Transactions = transactions
+
+	var investments []InvestmentTransaction
+	for _, investment := range item.Investments {
+		if w.contains(investment.Date.Time) {
+			investments = append(investments, investment)
+		}
+	}
+	item.Investments = investments
+}
+
+// ClampGains removes gains realized outside the window, or outside the
+// requested dates if the window isn't clamped. Gains may be realized before
+// the requested dates when lots are tracked from earlier history.
+func (w Window) ClampGains(gains []RealizedGain) []RealizedGain {
+	bounds := w
+	if w.End.IsZero() {
+		bounds.Start = w.FetchStart
+		bounds.End = w.FetchEnd.AddDate(0, 0, 1)
+	}
+
+	var clamped []RealizedGain
+	for _, gain := range gains {
+		if bounds.contains(gain.Sold) {
+			clamped = append(clamped, gain)
+		}
+	}
+	return clamped
+}
@@ -7,7 +7,7 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -17,46 +17,135 @@ const (
 	maxTransactionCount         = 500
 	plaidDomain                 = "plaid.com"
 	itemGetEndpoint             = "item/get"
+	accountsEndpoint            = "accounts/get"
 	transactionsEndpoint        = "transactions/get"
 	transactionsRefreshEndpoint = "transactions/refresh"
 	investmentsEndpoint         = "investments/transactions/get"
 	investmentsRefreshEndpoint  = "investments/refresh"
+	holdingsEndpoint            = "investments/holdings/get"
 
 	RefreshThresholdLimit = time.Hour * 168 // one week
 )
 
 type Config struct {
-	Environment string                 `yaml:"environment"`
-	ClientID    string                 `yaml:"client_id"`
-	Secret      string                 `yaml:"secret"`
-	Items       map[string]*ItemConfig `yaml:"items"` // map item ID to token and account IDs
+	Environment      string                    `yaml:"environment"`
+	ClientID         string                    `yaml:"client_id"`
+	Secret           string                    `yaml:"secret,omitempty"`
+	SecretEnv        string                    `yaml:"secret_env,omitempty"`     // environment variable holding the secret
+	SecretFile       string                    `yaml:"secret_file,omitempty"`    // file holding the secret
+	SecretCommand    string                    `yaml:"secret_command,omitempty"` // command printing the secret to stdout
+	BaseURL          string                    `yaml:"base_url,omitempty"`       // overrides the plaid API URL, e.g. for a fake server
+	Items            map[string]*ItemConfig    `yaml:"items"`                    // map item ID to token and account IDs
+	Budgets          []Budget                  `yaml:"budgets"`
+	Columns          ColumnsConfig             `yaml:"columns"` // csv layouts, defaulting to DefaultTransactionColumns and DefaultInvestmentColumns
+	CSV              CSVConfig                 `yaml:"csv"`
+	Payee            PayeeConfig               `yaml:"payee"`
+	Securities       map[string]SecurityConfig `yaml:"securities"`                  // map security ID, CUSIP, ISIN or SEDOL to symbol and name
+	CategoryTaxonomy CategoryTaxonomy          `yaml:"category_taxonomy,omitempty"` // legacy or pfc, defaulting to legacy
+	TimeZone         string                    `yaml:"time_zone,omitempty"`         // IANA time zone for dates, defaulting to UTC
+	FiscalYearStart  time.Month                `yaml:"fiscal_year_start,omitempty"` // month number, defaulting to January
+
+	Archive *Archive `yaml:"-"` // if set, raw responses from RequestActivity are saved here
 }
 
 type ItemConfig struct {
-	Name         string            `yaml:"name"`
-	Token        string            `yaml:"token"`
-	Transactions map[string]string `yaml:"transactions"` // map account IDs to names
-	Investments  map[string]string `yaml:"investments"`  // map account IDs to names
+	Name         string              `yaml:"name"`
+	Token        string              `yaml:"token,omitempty"`
+	TokenEnv     string              `yaml:"token_env,omitempty"`     // environment variable holding the access token
+	TokenFile    string              `yaml:"token_file,omitempty"`    // file holding the access token
+	TokenCommand string              `yaml:"token_command,omitempty"` // command printing the access token to stdout
+	Transactions map[string]string   `yaml:"transactions"`            // map account IDs to names
+	Investments  map[string]string   `yaml:"investments"`             // map account IDs to names
+	Lots         map[string][]string `yaml:"lots"`                    // map sell transaction IDs to lot transaction IDs
+	Noncovered   []string            `yaml:"noncovered"`              // account IDs whose cost basis isn't reported to the IRS
 }
 
 type ItemData struct {
 	ID           string
 	Transactions []Transaction
 	Investments  []InvestmentTransaction
+	Holdings     []Holding
+	Accounts     map[string]Account  // map account ID to account
 	Securities   map[string]Security // map security ID to security
 }
 
+func NewItemData(id string) *ItemData {
+	return &ItemData{
+		ID:         id,
+		Accounts:   make(map[string]Account),
+		Securities: make(map[string]Security),
+	}
+}
+
+func (i *ItemData) addTransactions(res *TransactionsResponse) {
+	i.Transactions = append(i.Transactions, res.Transactions...)
+	for _, account := range res.Accounts {
+		i.Accounts[account.ID] = account
+	}
+}
+
+func (i *ItemData) addInvestments(res *InvestmentTransactionsResponse) {
+	i.Investments = append(i.Investments, res.InvestmentTransactions...)
+	for _, account := range res.Accounts {
+		i.Accounts[account.ID] = account
+	}
+	for _, security := range res.Securities {
+		i.Securities[security.ID] = security
+	}
+}
+
+func (i *ItemData) addHoldings(res *HoldingsResponse) {
+	i.Holdings = append(i.Holdings, res.Holdings...)
+	for _, security := range res.Securities {
+		if _, ok := i.Securities[security.ID]; !ok {
+			i.Securities[security.ID] = security
+		}
+	}
+}
+
+// In moves dates to loc, keeping their calendar day, and converts datetimes
+// to loc
+func (i *ItemData) In(loc *time.Location) {
+	for idx := range i.Transactions {
+		transaction := &i.Transactions[idx]
+		transaction.Date = transaction.Date.In(loc)
+		transaction.AuthorizedDate = transaction.AuthorizedDate.In(loc)
+		if !transaction.Time.IsZero() {
+			transaction.Time = transaction.Time.In(loc)
+		}
+		if !transaction.AuthorizedTime.IsZero() {
+			transaction.AuthorizedTime = transaction.AuthorizedTime.In(loc)
+		}
+	}
+	for idx := range i.Investments {
+		i.Investments[idx].Date = i.Investments[idx].Date.In(loc)
+	}
+	for idx := range i.Holdings {
+		i.Holdings[idx].InstitutionPriceAsOf = i.Holdings[idx].InstitutionPriceAsOf.In(loc)
+	}
+	for id, security := range i.Securities {
+		security.ClosePriceAsOf = security.ClosePriceAsOf.In(loc)
+		i.Securities[id] = security
+	}
+}
+
+// Location returns the configured time zone, or UTC if none is configured
+func (c *Config) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.TimeZone)
+}
+
 func LoadConfig(filepath, environment string) (*Config, error) {
-	f, err := os.Open(filepath)
+	data, _, err := ReadConfigFile(filepath)
 	if err != nil {
-		return nil, fmt.Errorf("open config file: %w\n", err)
+		return nil, fmt.Errorf("read config file: %w", err)
 	}
-	defer f.Close()
 
-	configs := make(map[string]*Config)
-	err = yaml.NewDecoder(f).Decode(configs)
+	configs, err := ParseConfig(data)
 	if err != nil {
-		return nil, fmt.Errorf("decode config file: %w\n", err)
+		return nil, fmt.Errorf("parse config file: %w", err)
 	}
 
 	config, ok := configs[environment]
@@ -65,10 +154,36 @@ func LoadConfig(filepath, environment string) (*Config, error) {
 	}
 	config.Environment = environment
 
+	err = config.resolveSecrets()
+	if err != nil {
+		return nil, fmt.Errorf("resolve secrets: %w", err)
+	}
+
 	return config, nil
 }
 
-func RequestActivity(config *Config, start, end time.Time, refreshThreshold time.Duration) ([]*ItemData, error) {
+// ParseConfig decodes the configs for every environment in a config file
+func ParseConfig(data []byte) (map[string]*Config, error) {
+	configs := make(map[string]*Config)
+	err := yaml.NewDecoder(bytes.NewReader(data)).Decode(configs)
+	if err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+
+	return configs, nil
+}
+
+func (c *Config) endpointURL(endpoint string) string {
+	if c.BaseURL != "" {
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(c.BaseURL, "/"), endpoint)
+	}
+	return fmt.Sprintf("https://%s.%s/%s", c.Environment, plaidDomain, endpoint)
+}
+
+// RequestActivity requests transactions and investments for each configured
+// item, and holdings if requested, as they're billed separately and only
+// needed for prices. If config.Archive is set, raw responses are saved to it.
+func RequestActivity(config *Config, start, end time.Time, refreshThreshold time.Duration, holdings bool) ([]*ItemData, error) {
 	items := make([]*ItemData, 0, len(config.Items))
 	for itemID, itemConfig := range config.Items {
 		if refreshThreshold < RefreshThresholdLimit {
@@ -78,59 +193,113 @@ func RequestActivity(config *Config, start, end time.Time, refreshThreshold time
 			}
 		}
 
-		item := &ItemData{
-			ID:         itemID,
-			Securities: make(map[string]Security),
-		}
+		item := NewItemData(itemID)
 
 		if len(itemConfig.Transactions) > 0 {
-			transactionsRes, err := requestItemTransactions(config, itemConfig, start, end, 0)
-			if err != nil {
-				return nil, fmt.Errorf("request item %q transactions: %w", itemID, err)
-			}
-			item.Transactions = append(item.Transactions, transactionsRes.Transactions...)
-
-			transactionsTotal := transactionsRes.Total
-			for transactionsRes.Total >= maxTransactionCount {
-				transactionsRes, err = requestItemTransactions(config, itemConfig, start, end, transactionsTotal)
+			var page, total int
+			for page == 0 || len(item.Transactions) < total {
+				transactionsRes, raw, err := requestItemTransactions(config, itemConfig, start, end, len(item.Transactions))
 				if err != nil {
 					return nil, fmt.Errorf("request item %q transactions: %w", itemID, err)
 				}
-				item.Transactions = append(item.Transactions, transactionsRes.Transactions...)
-				transactionsTotal += transactionsRes.Total
+				err = config.archive(itemID, archiveTransactions, page, raw)
+				if err != nil {
+					return nil, fmt.Errorf("archive item %q transactions: %w", itemID, err)
+				}
+				item.addTransactions(transactionsRes)
+				if len(transactionsRes.Transactions) == 0 {
+					break
+				}
+				total = transactionsRes.Total
+				page += 1
 			}
 		}
 
 		if len(itemConfig.Investments) > 0 {
-			investmentsRes, err := requestItemInvestments(config, itemConfig, start, end, 0)
+			err := requestInvestments(config, itemID, itemConfig, item, start, end)
 			if err != nil {
-				return nil, fmt.Errorf("request item %q investments: %w", itemID, err)
-			}
-			item.Investments = append(item.Investments, investmentsRes.InvestmentTransactions...)
-			for _, security := range investmentsRes.Securities {
-				item.Securities[security.ID] = security
+				return nil, err
 			}
+		}
 
-			investmentsTotal := investmentsRes.Total
-			for investmentsRes.Total >= maxTransactionCount {
-				investmentsRes, err = requestItemInvestments(config, itemConfig, start, end, investmentsTotal)
-				if err != nil {
-					return nil, fmt.Errorf("request item %q investments: %w", itemID, err)
-				}
-				item.Investments = append(item.Investments, investmentsRes.InvestmentTransactions...)
-				for _, security := range investmentsRes.Securities {
-					item.Securities[security.ID] = security
-				}
-				investmentsTotal += investmentsRes.Total
+		if len(itemConfig.Investments) > 0 && holdings {
+			holdingsRes, raw, err := requestItemHoldings(config, itemConfig)
+			if err != nil {
+				return nil, fmt.Errorf("request item %q holdings: %w", itemID, err)
 			}
+			err = config.archive(itemID, archiveHoldings, 0, raw)
+			if err != nil {
+				return nil, fmt.Errorf("archive item %q holdings: %w", itemID, err)
+			}
+			item.addHoldings(holdingsRes)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// RequestInvestmentHistory requests investment transactions for each
+// configured item with investment accounts, for seeding lots with purchases
+// made before the dates being written. Responses aren't archived.
+func RequestInvestmentHistory(config *Config, start, end time.Time) ([]*ItemData, error) {
+	history := *config
+	history.Archive = nil
+
+	items := make([]*ItemData, 0, len(config.Items))
+	for itemID, itemConfig := range config.Items {
+		if len(itemConfig.Investments) == 0 {
+			continue
 		}
 
+		item := NewItemData(itemID)
+		err := requestInvestments(&history, itemID, itemConfig, item, start, end)
+		if err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 
 	return items, nil
 }
 
+// requestInvestments requests every page of an item's investment
+// transactions, adding them to item
+func requestInvestments(config *Config, itemID string, itemConfig *ItemConfig, item *ItemData, start, end time.Time) error {
+	var page, total int
+	for page == 0 || len(item.Investments) < total {
+		investmentsRes, raw, err := requestItemInvestments(config, itemConfig, start, end, len(item.Investments))
+		if err != nil {
+			return fmt.Errorf("request item %q investments: %w", itemID, err)
+		}
+		err = config.archive(itemID, archiveInvestments, page, raw)
+		if err != nil {
+			return fmt.Errorf("archive item %q investments: %w", itemID, err)
+		}
+		item.addInvestments(investmentsRes)
+		if len(investmentsRes.InvestmentTransactions) == 0 {
+			break
+		}
+		total = investmentsRes.Total
+		page += 1
+	}
+	return nil
+}
+
+func RequestAccounts(config *Config) (map[string][]Account, error) {
+	accounts := make(map[string][]Account, len(config.Items))
+	for itemID, itemConfig := range config.Items {
+		res, err := requestAccounts(config, itemConfig)
+		if err != nil {
+			return nil, fmt.Errorf("request item %q accounts: %w", itemID, err)
+		}
+		accounts[itemID] = res.Accounts
+	}
+
+	return accounts, nil
+}
+
 func checkRefresh(config *Config, itemID string, itemConfig *ItemConfig, refreshThreshold time.Duration) error {
 	now := time.Now()
 	res, err := requestItem(config, itemConfig)
@@ -173,20 +342,16 @@ func checkRefresh(config *Config, itemID string, itemConfig *ItemConfig, refresh
 	return nil
 }
 
-func requestItem(config *Config, itemConfig *ItemConfig) (*ItemGetResponse, error) {
-	request := &BasicRequest{
-		ClientID:    config.ClientID,
-		Secret:      config.Secret,
-		AccessToken: itemConfig.Token,
-	}
-
+// post sends a request to a plaid endpoint and decodes the response body into
+// response, returning the raw body as well
+func (c *Config) post(endpoint string, request, response interface{}) ([]byte, error) {
 	var body bytes.Buffer
 	err := json.NewEncoder(&body).Encode(request)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("https://%s.%s/%s", config.Environment, plaidDomain, itemGetEndpoint)
+	url := c.endpointURL(endpoint)
 	req, err := http.NewRequest(http.MethodPost, url, &body)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
@@ -196,76 +361,83 @@ func requestItem(config *Config, itemConfig *ItemConfig) (*ItemGetResponse, erro
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
 	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
 
 	switch res.StatusCode {
 	case http.StatusOK:
 	case http.StatusBadRequest:
-		b, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("read err response body: %w", err)
-		}
 		log.Printf("API Error:\n%s\n", string(b))
 		fallthrough
 	default:
 		return nil, fmt.Errorf("bad response: %s", res.Status)
 	}
 
-	var response ItemGetResponse
-	err = json.NewDecoder(res.Body).Decode(&response)
+	err = json.Unmarshal(b, response)
 	if err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
 
-	return &response, nil
+	return b, nil
 }
 
-func requestRefresh(config *Config, itemConfig *ItemConfig, endpoint string) (*RefreshResponse, error) {
+func requestItem(config *Config, itemConfig *ItemConfig) (*ItemGetResponse, error) {
 	request := &BasicRequest{
 		ClientID:    config.ClientID,
 		Secret:      config.Secret,
 		AccessToken: itemConfig.Token,
 	}
 
-	var body bytes.Buffer
-	err := json.NewEncoder(&body).Encode(request)
+	var response ItemGetResponse
+	_, err := config.post(itemGetEndpoint, request, &response)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+		return nil, err
 	}
 
-	url := fmt.Sprintf("https://%s.%s/%s", config.Environment, plaidDomain, endpoint)
-	req, err := http.NewRequest(http.MethodPost, url, &body)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+	return &response, nil
+}
+
+func requestAccounts(config *Config, itemConfig *ItemConfig) (*AccountsResponse, error) {
+	request := &BasicRequest{
+		ClientID:    config.ClientID,
+		Secret:      config.Secret,
+		AccessToken: itemConfig.Token,
 	}
-	req.Header.Add("content-type", "application/json")
-	res, err := http.DefaultClient.Do(req)
+
+	var response AccountsResponse
+	_, err := config.post(accountsEndpoint, request, &response)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, err
 	}
 
-	switch res.StatusCode {
-	case http.StatusOK:
-	case http.StatusBadRequest:
-		b, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("read err response body: %w", err)
-		}
-		log.Printf("API Error:\n%s\n", string(b))
-		fallthrough
-	default:
-		return nil, fmt.Errorf("bad response: %s", res.Status)
+	if rerr := response.Item.Error; rerr.Type != "" {
+		return &response, fmt.Errorf("response error: %s %s %s", rerr.Type, rerr.Code, rerr.Message)
+	}
+
+	return &response, nil
+}
+
+func requestRefresh(config *Config, itemConfig *ItemConfig, endpoint string) (*RefreshResponse, error) {
+	request := &BasicRequest{
+		ClientID:    config.ClientID,
+		Secret:      config.Secret,
+		AccessToken: itemConfig.Token,
 	}
 
 	var response RefreshResponse
-	err = json.NewDecoder(res.Body).Decode(&response)
+	_, err := config.post(endpoint, request, &response)
 	if err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+		return nil, err
 	}
 
 	return &response, nil
 }
 
-func requestItemTransactions(config *Config, itemConfig *ItemConfig, start, end time.Time, offset int) (*TransactionsResponse, error) {
+func requestItemTransactions(config *Config, itemConfig *ItemConfig, start, end time.Time, offset int) (*TransactionsResponse, []byte, error) {
 	accounts := make([]string, 0, len(itemConfig.Transactions))
 	for id := range itemConfig.Transactions {
 		accounts = append(accounts, id)
@@ -278,57 +450,28 @@ func requestItemTransactions(config *Config, itemConfig *ItemConfig, start, end
 		StartDate:   start.Format(time.DateOnly),
 		EndDate:     end.Format(time.DateOnly),
 		Options: TransactionsRequestOptions{
-			Count:                      maxTransactionCount,
-			Offset:                     offset,
-			AccountIDs:                 accounts,
-			IncludeOriginalDescription: true,
+			Count:                          maxTransactionCount,
+			Offset:                         offset,
+			AccountIDs:                     accounts,
+			IncludeOriginalDescription:     true,
+			IncludePersonalFinanceCategory: true,
 		},
 	}
 
-	var body bytes.Buffer
-	err := json.NewEncoder(&body).Encode(request)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
-	}
-
-	url := fmt.Sprintf("https://%s.%s/%s", config.Environment, plaidDomain, transactionsEndpoint)
-	req, err := http.NewRequest(http.MethodPost, url, &body)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Add("content-type", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
-	}
-
-	switch res.StatusCode {
-	case http.StatusOK:
-	case http.StatusBadRequest:
-		b, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("read err response body: %w", err)
-		}
-		log.Printf("API Error:\n%s\n", string(b))
-		fallthrough
-	default:
-		return nil, fmt.Errorf("bad response: %s", res.Status)
-	}
-
 	var response TransactionsResponse
-	err = json.NewDecoder(res.Body).Decode(&response)
+	raw, err := config.post(transactionsEndpoint, request, &response)
 	if err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+		return nil, nil, err
 	}
 
 	if rerr := response.Item.Error; rerr.Type != "" {
-		return &response, fmt.Errorf("response error: %s %s %s", rerr.Type, rerr.Code, rerr.Message)
+		return &response, raw, fmt.Errorf("response error: %s %s %s", rerr.Type, rerr.Code, rerr.Message)
 	}
 
-	return &response, nil
+	return &response, raw, nil
 }
 
-func requestItemInvestments(config *Config, itemConfig *ItemConfig, start, end time.Time, offset int) (*InvestmentTransactionsResponse, error) {
+func requestItemInvestments(config *Config, itemConfig *ItemConfig, start, end time.Time, offset int) (*InvestmentTransactionsResponse, []byte, error) {
 	accounts := make([]string, 0, len(itemConfig.Investments))
 	for id := range itemConfig.Investments {
 		accounts = append(accounts, id)
@@ -348,45 +491,43 @@ func requestItemInvestments(config *Config, itemConfig *ItemConfig, start, end t
 		},
 	}
 
-	var body bytes.Buffer
-	err := json.NewEncoder(&body).Encode(request)
+	var response InvestmentTransactionsResponse
+	raw, err := config.post(investmentsEndpoint, request, &response)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+		return nil, nil, err
 	}
 
-	url := fmt.Sprintf("https://%s.%s/%s", config.Environment, plaidDomain, investmentsEndpoint)
-	req, err := http.NewRequest(http.MethodPost, url, &body)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+	if rerr := response.Item.Error; rerr.Type != "" {
+		return &response, raw, fmt.Errorf("response error: %s %s %s", rerr.Type, rerr.Code, rerr.Message)
 	}
-	req.Header.Add("content-type", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+
+	return &response, raw, nil
+}
+
+func requestItemHoldings(config *Config, itemConfig *ItemConfig) (*HoldingsResponse, []byte, error) {
+	accounts := make([]string, 0, len(itemConfig.Investments))
+	for id := range itemConfig.Investments {
+		accounts = append(accounts, id)
 	}
 
-	switch res.StatusCode {
-	case http.StatusOK:
-	case http.StatusBadRequest:
-		b, err := io.ReadAll(res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("read err response body: %w", err)
-		}
-		log.Printf("API Error:\n%s\n", string(b))
-		fallthrough
-	default:
-		return nil, fmt.Errorf("bad response: %s", res.Status)
+	request := &HoldingsRequest{
+		ClientID:    config.ClientID,
+		Secret:      config.Secret,
+		AccessToken: itemConfig.Token,
+		Options: HoldingsRequestOptions{
+			AccountIDs: accounts,
+		},
 	}
 
-	var response InvestmentTransactionsResponse
-	err = json.NewDecoder(res.Body).Decode(&response)
+	var response HoldingsResponse
+	raw, err := config.post(holdingsEndpoint, request, &response)
 	if err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+		return nil, nil, err
 	}
 
 	if rerr := response.Item.Error; rerr.Type != "" {
-		return &response, fmt.Errorf("response error: %s %s %s", rerr.Type, rerr.Code, rerr.Message)
+		return &response, raw, fmt.Errorf("response error: %s %s %s", rerr.Type, rerr.Code, rerr.Message)
 	}
 
-	return &response, nil
+	return &response, raw, nil
 }
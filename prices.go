@@ -0,0 +1,409 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PriceFormat string
+
+const (
+	PriceFormatLedger    PriceFormat = "ledger"
+	PriceFormatBeancount PriceFormat = "beancount"
+	PriceFormatCSV       PriceFormat = "csv"
+
+	DefaultPriceFormat = PriceFormatLedger
+)
+
+func ParsePriceFormat(format string) (PriceFormat, error) {
+	switch f := PriceFormat(format); f {
+	case PriceFormatLedger, PriceFormatBeancount, PriceFormatCSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown price format: %q", format)
+	}
+}
+
+// beancount commodities are upper case, start with a letter and end with a
+// letter or digit
+var beancountCommodityPattern = regexp.MustCompile(`^[A-Z]([A-Z0-9'._-]{0,22}[A-Z0-9])?$`)
+
+type Price struct {
+	Date     time.Time
+	Symbol   string
+	Amount   float64
+	Currency string
+}
+
+type priceKey struct {
+	date     string
+	symbol   string
+	currency string
+}
+
+func (p Price) key() priceKey {
+	return priceKey{p.Date.Format(time.DateOnly), p.Symbol, p.Currency}
+}
+
+// CommoditySymbol picks the most recognizable identifier available for a
+// security, preferring a configured symbol, then the OCC symbol for options,
+// then the ticker and falling back to CUSIP, ISIN, SEDOL and finally plaid's
+// security ID
+func CommoditySymbol(security Security) string {
+	if security.symbol != "" {
+		return security.symbol
+	}
+	if symbol := security.OptionContract.OCCSymbol(); symbol != "" {
+		return symbol
+	}
+	for _, symbol := range []string{security.TickerSymbol, security.CUSIP, security.ISIN, security.SEDOL} {
+		if symbol != "" {
+			return symbol
+		}
+	}
+	return security.ID
+}
+
+// OCCSymbol returns the contract's OCC option symbol without the padding
+// between root and expiration, e.g. AAPL240119C00150000, so that it can be
+// used as a commodity. It returns an empty string if the contract is nil or
+// incomplete.
+func (c *OptionContract) OCCSymbol() string {
+	if c == nil || c.UnderlyingSecurityTicker == "" || c.ExpirationDate.IsZero() {
+		return ""
+	}
+
+	var right string
+	switch strings.ToLower(c.ContractType) {
+	case OptionCall:
+		right = "C"
+	case OptionPut:
+		right = "P"
+	default:
+		return ""
+	}
+
+	// strike in thousandths of a dollar
+	strike := int64(math.Round(c.StrikePrice * 1000))
+	return fmt.Sprintf("%s%s%s%08d", strings.ToUpper(c.UnderlyingSecurityTicker), c.ExpirationDate.Format("060102"), right, strike)
+}
+
+// CollectPrices gathers security close prices and holding institution prices
+// from an item. Prices without an as-of date are dropped.
+func CollectPrices(item *ItemData) []Price {
+	var prices []Price
+	for _, security := range item.Securities {
+		if security.Type == SecurityTypeCash || security.ClosePrice == 0 {
+			continue
+		}
+
+		date := security.ClosePriceAsOf.Time
+		if date.IsZero() {
+			date = security.UpdateDatetime
+		}
+		if date.IsZero() {
+			continue
+		}
+
+		currency := security.ISOCurrency
+		if security.UnofficialCurrency != "" {
+			currency = security.UnofficialCurrency
+		}
+
+		prices = append(prices, Price{
+			Date:     date,
+			Symbol:   CommoditySymbol(security),
+			Amount:   security.ClosePrice,
+			Currency: currency,
+		})
+	}
+
+	for _, holding := range item.Holdings {
+		security, ok := item.Securities[holding.SecurityID]
+		if !ok || security.Type == SecurityTypeCash || holding.InstitutionPrice == 0 {
+			continue
+		}
+
+		date := holding.InstitutionPriceAsOf.Time
+		if date.IsZero() {
+			date = holding.InstitutionPriceDatetime
+		}
+		if date.IsZero() {
+			continue
+		}
+
+		currency := holding.ISOCurrency
+		if holding.UnofficialCurrency != "" {
+			currency = holding.UnofficialCurrency
+		}
+
+		prices = append(prices, Price{
+			Date:     date,
+			Symbol:   CommoditySymbol(security),
+			Amount:   holding.InstitutionPrice,
+			Currency: currency,
+		})
+	}
+
+	return prices
+}
+
+// MergePrices deduplicates prices by date, symbol and currency, with later
+// prices replacing earlier ones, and sorts the result by date and symbol
+func MergePrices(prices ...[]Price) []Price {
+	merged := make(map[priceKey]Price)
+	for _, list := range prices {
+		for _, price := range list {
+			merged[price.key()] = price
+		}
+	}
+
+	result := make([]Price, 0, len(merged))
+	for _, price := range merged {
+		result = append(result, price)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].key(), result[j].key()
+		if a.date != b.date {
+			return a.date < b.date
+		}
+		if a.symbol != b.symbol {
+			return a.symbol < b.symbol
+		}
+		return a.currency < b.currency
+	})
+
+	return result
+}
+
+// ReadPrices reads prices in the given format. The dialect is only used by
+// the csv format. Malformed prices are skipped with a warning.
+func ReadPrices(input io.Reader, format PriceFormat, dialect Dialect) ([]Price, error) {
+	if format == PriceFormatCSV {
+		return readCSVPrices(input, dialect)
+	}
+
+	var prices []Price
+	var lineNumber int
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		var fields []string
+		switch format {
+		case PriceFormatLedger:
+			if !strings.HasPrefix(line, "P ") {
+				continue
+			}
+			fields = splitPriceFields(line[2:])
+		case PriceFormatBeancount:
+			fields = splitPriceFields(line)
+			if len(fields) < 2 || fields[1] != "price" {
+				continue
+			}
+			fields = append(fields[:1], fields[2:]...)
+		}
+
+		if len(fields) < 3 {
+			log.Printf("Warning: prices line %d: skipping malformed price: %q\n", lineNumber, line)
+			continue
+		}
+		price, err := parsePrice(fields)
+		if err != nil {
+			log.Printf("Warning: prices line %d: skipping price: %s\n", lineNumber, err)
+			continue
+		}
+		prices = append(prices, price)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan prices: %w", err)
+	}
+
+	return prices, nil
+}
+
+func readCSVPrices(input io.Reader, dialect Dialect) ([]Price, error) {
+	comma, err := dialect.Comma()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(input)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1 // short records are skipped below
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read csv: %w", err)
+	}
+
+	var prices []Price
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.TrimPrefix(record[0], ByteOrderMark) == "Date" {
+			continue // header
+		}
+		if len(record) < 3 {
+			log.Printf("Warning: prices record %d: skipping malformed price: %q\n", i+1, strings.Join(record, string(comma)))
+			continue
+		}
+		record[2] = dialect.parseDecimal(record[2])
+		price, err := parsePrice(record)
+		if err != nil {
+			log.Printf("Warning: prices record %d: skipping price: %s\n", i+1, err)
+			continue
+		}
+		prices = append(prices, price)
+	}
+
+	return prices, nil
+}
+
+// parsePrice parses date, symbol, amount and optional currency fields
+func parsePrice(fields []string) (Price, error) {
+	date, err := time.Parse(time.DateOnly, strings.ReplaceAll(fields[0], "/", "-"))
+	if err != nil {
+		return Price{}, fmt.Errorf("parse date: %w", err)
+	}
+
+	amount, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return Price{}, fmt.Errorf("parse amount: %w", err)
+	}
+
+	price := Price{
+		Date:   date,
+		Symbol: fields[1],
+		Amount: amount,
+	}
+	if len(fields) > 3 {
+		price.Currency = fields[3]
+	}
+
+	return price, nil
+}
+
+// splitPriceFields splits on whitespace, keeping double quoted commodity
+// symbols together and unquoted
+func splitPriceFields(line string) []string {
+	var fields []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end >= 0 {
+				fields = append(fields, line[1:end+1])
+				line = line[end+2:]
+				continue
+			}
+		}
+
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+	return fields
+}
+
+// ledgerCommodity quotes commodities containing digits or special characters,
+// as ledger requires
+func ledgerCommodity(symbol string) string {
+	if strings.ContainsAny(symbol, "0123456789 -.") {
+		return strconv.Quote(symbol)
+	}
+	return symbol
+}
+
+// beancountCommodity returns symbol as a beancount commodity, upper casing
+// it, and false if it still isn't valid, such as a CUSIP starting with a digit
+// or a symbol longer than 24 characters
+func beancountCommodity(symbol string) (string, bool) {
+	symbol = strings.ToUpper(symbol)
+	return symbol, beancountCommodityPattern.MatchString(symbol)
+}
+
+// WritePrices writes prices in the given format, the csv format using the
+// options' dialect and price format. Prices for symbols that can't be
+// written as beancount commodities are skipped with a warning; configure a
+// symbol for those securities.
+func WritePrices(output io.Writer, prices []Price, format PriceFormat, options *WriteOptions) error {
+	if format == PriceFormatCSV {
+		if options.Dialect.BOM {
+			if _, err := io.WriteString(output, ByteOrderMark); err != nil {
+				return fmt.Errorf("write byte order mark: %w", err)
+			}
+		}
+
+		writer, err := NewRecordWriter(output, options.Dialect)
+		if err != nil {
+			return fmt.Errorf("create csv writer: %w", err)
+		}
+		writer.Write([]string{"Date", "Symbol", "Price", "Currency"})
+		for _, price := range prices {
+			writer.Write([]string{
+				price.Date.Format(time.DateOnly),
+				price.Symbol,
+				options.formatPrice(price.Amount),
+				price.Currency,
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("write csv: %w", err)
+		}
+		return nil
+	}
+
+	if format == PriceFormatBeancount {
+		// upper casing may make symbols collide with prices already written
+		var commodities []Price
+		skipped := make(map[string]bool)
+		for _, price := range prices {
+			symbol, ok := beancountCommodity(price.Symbol)
+			if !ok {
+				if !skipped[price.Symbol] {
+					log.Printf("Warning: skipped prices for %q, which isn't a valid beancount commodity; configure a symbol for the security\n", price.Symbol)
+					skipped[price.Symbol] = true
+				}
+				continue
+			}
+			price.Symbol = symbol
+			commodities = append(commodities, price)
+		}
+		prices = MergePrices(commodities)
+	}
+
+	for _, price := range prices {
+		var line string
+		// ledger and beancount reject exponents, which %g produces for small
+		// and large prices, so the price format only applies to csv
+		amount := strings.TrimSpace(strconv.FormatFloat(price.Amount, 'f', -1, 64) + " " + price.Currency)
+		switch format {
+		case PriceFormatLedger:
+			line = fmt.Sprintf("P %s %s %s\n", price.Date.Format(time.DateOnly), ledgerCommodity(price.Symbol), amount)
+		case PriceFormatBeancount:
+			line = fmt.Sprintf("%s price %s %s\n", price.Date.Format(time.DateOnly), price.Symbol, amount)
+		default:
+			return fmt.Errorf("unknown price format: %q", format)
+		}
+
+		if _, err := io.WriteString(output, line); err != nil {
+			return fmt.Errorf("write price: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	UncategorizedCategory = "Uncategorized"
+
+	reportMonthFormat = "2006-01"
+)
+
+// SpendingReport pivots transaction amounts by category against months.
+// Amounts follow plaid's sign convention, so spending is positive and
+// refunds and income are negative.
+type SpendingReport struct {
+	Months     []string           `json:"months"`
+	Categories []CategorySpending `json:"categories"`
+	Totals     []float64          `json:"totals"` // per month
+	Total      float64            `json:"total"`
+	Average    float64            `json:"average"`
+}
+
+type CategorySpending struct {
+	Category string    `json:"category"`
+	Depth    int       `json:"depth"` // 1 for top level categories
+	Amounts  []float64 `json:"amounts"`
+	Total    float64   `json:"total"`
+	Average  float64   `json:"average"`
+	Change   *float64  `json:"change"` // percent change over the last two months, nil if undefined
+}
+
+// TransactionDate returns the date a transaction was authorized, falling back
+// to the post date
+func TransactionDate(transaction Transaction) time.Time {
+	if !transaction.AuthorizedDate.Time.IsZero() {
+		return transaction.AuthorizedDate.Time
+	}
+	return transaction.Date.Time
+}
+
+// NewSpendingReport totals transactions per month for every level of the
+// category hierarchy down to depth, or all levels if depth is zero
+func NewSpendingReport(transactions []Transaction, delimiter string, depth int) *SpendingReport {
+	report := &SpendingReport{}
+	if len(transactions) == 0 {
+		return report
+	}
+
+	first, last := TransactionDate(transactions[0]), TransactionDate(transactions[0])
+	for _, transaction := range transactions {
+		date := TransactionDate(transaction)
+		if date.Before(first) {
+			first = date
+		}
+		if date.After(last) {
+			last = date
+		}
+	}
+
+	monthIndex := make(map[string]int)
+	month := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, first.Location())
+	for !month.After(last) {
+		monthIndex[month.Format(reportMonthFormat)] = len(report.Months)
+		report.Months = append(report.Months, month.Format(reportMonthFormat))
+		month = month.AddDate(0, 1, 0)
+	}
+
+	categories := make(map[string]*CategorySpending)
+	report.Totals = make([]float64, len(report.Months))
+	for _, transaction := range transactions {
+		i := monthIndex[TransactionDate(transaction).Format(reportMonthFormat)]
+		report.Totals[i] += transaction.Amount
+
+		hierarchy := transaction.Category
+		if len(hierarchy) == 0 {
+			hierarchy = []string{UncategorizedCategory}
+		}
+		if depth > 0 && len(hierarchy) > depth {
+			hierarchy = hierarchy[:depth]
+		}
+
+		for level := 1; level <= len(hierarchy); level++ {
+			name := strings.Join(hierarchy[:level], delimiter)
+			category, ok := categories[name]
+			if !ok {
+				category = &CategorySpending{
+					Category: name,
+					Depth:    level,
+					Amounts:  make([]float64, len(report.Months)),
+				}
+				categories[name] = category
+			}
+			category.Amounts[i] += transaction.Amount
+		}
+	}
+
+	for _, category := range categories {
+		for _, amount := range category.Amounts {
+			category.Total += amount
+		}
+		category.Average = category.Total / float64(len(report.Months))
+		category.Change = percentChange(category.Amounts)
+		report.Categories = append(report.Categories, *category)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		return report.Categories[i].Category < report.Categories[j].Category
+	})
+
+	for _, total := range report.Totals {
+		report.Total += total
+	}
+	report.Average = report.Total / float64(len(report.Months))
+
+	return report
+}
+
+func percentChange(amounts []float64) *float64 {
+	if len(amounts) < 2 || amounts[len(amounts)-2] == 0 {
+		return nil
+	}
+	previous, current := amounts[len(amounts)-2], amounts[len(amounts)-1]
+	change := (current - previous) / previous * 100
+	return &change
+}
+
+// ReadTransactions reads transactions from csv output with a header row,
+// such as that written by WriteTransactions. Only the date, amount,
+// category, account, payee, currency and ID columns are read, with the
+// configured account name read into AccountID.
+func ReadTransactions(input io.Reader, options *WriteOptions) ([]Transaction, error) {
+	comma, err := options.Dialect.Comma()
+	if err != nil {
+		return nil, fmt.Errorf("parse delimiter: %w", err)
+	}
+
+	reader := csv.NewReader(input)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimPrefix(name, ByteOrderMark)] = i
+	}
+	for _, required := range []string{"Post Date", "Amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column: %q", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var transactions []Transaction
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read record: %w", err)
+		}
+
+		var transaction Transaction
+		transaction.Date.Time, err = time.ParseInLocation(options.PostDateFormat, field(record, "Post Date"), options.location())
+		if err != nil {
+			return nil, fmt.Errorf("parse post date: %w", err)
+		}
+		if authorized := field(record, "Authorized Date"); authorized != "" {
+			transaction.AuthorizedDate.Time, err = time.ParseInLocation(options.AuthDateFormat, authorized, options.location())
+			if err != nil {
+				return nil, fmt.Errorf("parse authorized date: %w", err)
+			}
+		}
+
+		transaction.Amount, err = strconv.ParseFloat(options.Dialect.parseDecimal(field(record, "Amount")), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse amount: %w", err)
+		}
+
+		if category := field(record, "Category"); category != "" {
+			transaction.Category = strings.Split(category, options.CategoryDelimiter)
+		}
+		transaction.AccountID = field(record, "Account")
+		transaction.Name = field(record, "Payee")
+		transaction.ISOCurrency = field(record, "Currency")
+		transaction.ID = field(record, "Transaction ID")
+
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,95 @@
+package ledger
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// resolveSecret returns the literal value or the value read from exactly one
+// of an environment variable, a file or a command's stdout
+func resolveSecret(value, env, file, command string) (string, error) {
+	if countSources(value, env, file, command) > 1 {
+		return "", fmt.Errorf("multiple sources specified")
+	}
+
+	switch {
+	case env != "":
+		secret, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("environment variable not set: %q", env)
+		}
+		return strings.TrimSpace(secret), nil
+	case file != "":
+		b, err := os.ReadFile(ExpandHome(file))
+		if err != nil {
+			return "", fmt.Errorf("read file: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	case command != "":
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = os.Stdin // allow commands to prompt, e.g. for a passphrase
+		cmd.Stderr = os.Stderr
+		b, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("run command: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	default:
+		return value, nil
+	}
+}
+
+// resolveSecrets replaces secret references in the config with their values
+func (c *Config) resolveSecrets() error {
+	secret, err := resolveSecret(c.Secret, c.SecretEnv, c.SecretFile, c.SecretCommand)
+	if err != nil {
+		return fmt.Errorf("resolve secret: %w", err)
+	}
+	c.Secret = secret
+
+	for itemID, itemConfig := range c.Items {
+		token, err := resolveSecret(itemConfig.Token, itemConfig.TokenEnv, itemConfig.TokenFile, itemConfig.TokenCommand)
+		if err != nil {
+			return fmt.Errorf("resolve item %q token: %w", itemID, err)
+		}
+		itemConfig.Token = token
+	}
+
+	return nil
+}
+
+// MarshalYAML omits the resolved secret when it was loaded from a reference
+func (c Config) MarshalYAML() (interface{}, error) {
+	type config Config
+	out := config(c)
+	if c.SecretEnv != "" || c.SecretFile != "" || c.SecretCommand != "" {
+		out.Secret = ""
+	}
+	return out, nil
+}
+
+// MarshalYAML omits the resolved token when it was loaded from a reference
+func (c ItemConfig) MarshalYAML() (interface{}, error) {
+	type itemConfig ItemConfig
+	out := itemConfig(c)
+	if c.TokenEnv != "" || c.TokenFile != "" || c.TokenCommand != "" {
+		out.Token = ""
+	}
+	return out, nil
+}
+
+// ExpandHome replaces a leading ~ with the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,90 @@
+package ledger
+
+import "sort"
+
+// SecurityConfig overrides how a security is named in outputs
+type SecurityConfig struct {
+	Symbol string `yaml:"symbol,omitempty"` // commodity symbol, replacing the ticker
+	Name   string `yaml:"name,omitempty"`
+}
+
+// UnmappedSecurity is a security without a configured mapping
+type UnmappedSecurity struct {
+	ItemID   string
+	Security Security
+	Symbol   string // symbol used in outputs
+}
+
+// securityMapping returns the configured mapping for a security, looked up
+// by plaid's security ID, CUSIP, ISIN and SEDOL in that order
+func (c *Config) securityMapping(security Security) (SecurityConfig, bool) {
+	for _, id := range []string{security.ID, security.CUSIP, security.ISIN, security.SEDOL} {
+		if id == "" {
+			continue
+		}
+		if mapping, ok := c.Securities[id]; ok {
+			return mapping, true
+		}
+	}
+	return SecurityConfig{}, false
+}
+
+// MapSecurities applies configured symbols and names to item's securities.
+// Configured symbols are shown in place of tickers and take precedence over
+// option symbols, while the ticker itself is kept so option contracts still
+// match their underlying.
+func (c *Config) MapSecurities(item *ItemData) {
+	for id, security := range item.Securities {
+		mapping, ok := c.securityMapping(security)
+		if !ok {
+			continue
+		}
+
+		if mapping.Symbol != "" {
+			security.symbol = mapping.Symbol
+		}
+		if mapping.Name != "" {
+			security.Name = mapping.Name
+		}
+		item.Securities[id] = security
+	}
+}
+
+// UnmappedSecurities lists securities in activity without a configured
+// mapping, sorted by item and name. Cash securities are omitted, as are
+// securities with a ticker or option symbol unless all is set.
+func UnmappedSecurities(config *Config, activity []*ItemData, all bool) []UnmappedSecurity {
+	var unmapped []UnmappedSecurity
+	for _, item := range activity {
+		for _, security := range item.Securities {
+			if security.Type == SecurityTypeCash {
+				continue
+			}
+			if _, ok := config.securityMapping(security); ok {
+				continue
+			}
+			if !all && (security.TickerSymbol != "" || security.OptionContract.OCCSymbol() != "") {
+				continue
+			}
+
+			unmapped = append(unmapped, UnmappedSecurity{
+				ItemID:   item.ID,
+				Security: security,
+				Symbol:   CommoditySymbol(security),
+			})
+		}
+	}
+
+	sort.Slice(unmapped, func(i, j int) bool {
+		a, b := unmapped[i], unmapped[j]
+		if a.ItemID != b.ItemID {
+			return a.ItemID < b.ItemID
+		}
+		if a.Security.Name != b.Security.Name {
+			return a.Security.Name < b.Security.Name
+		}
+		return a.Security.ID < b.Security.ID
+	})
+
+	return unmapped
+}
@@ -0,0 +1,70 @@
+package ledger
+
+import (
+	"fmt"
+	"time"
+)
+
+const consentExpirationWarning = time.Hour * 168 // one week
+
+type ItemHealth struct {
+	ID           string     `json:"item_id"`
+	Name         string     `json:"name"`
+	Item         Item       `json:"item"`
+	Status       ItemStatus `json:"status"`
+	RequestError string     `json:"request_error,omitempty"`
+	Problems     []string   `json:"problems"`
+}
+
+func (h *ItemHealth) NeedsAttention() bool {
+	return len(h.Problems) > 0
+}
+
+// RequestItemHealth fetches the status of every configured item. Request
+// failures are recorded on the item rather than returned so that one broken
+// item doesn't hide the state of the others.
+func RequestItemHealth(config *Config) []*ItemHealth {
+	now := time.Now()
+	health := make([]*ItemHealth, 0, len(config.Items))
+	for itemID, itemConfig := range config.Items {
+		h := &ItemHealth{
+			ID:       itemID,
+			Name:     itemConfig.Name,
+			Problems: []string{},
+		}
+		health = append(health, h)
+
+		res, err := requestItem(config, itemConfig)
+		if err != nil {
+			h.RequestError = err.Error()
+			h.Problems = append(h.Problems, fmt.Sprintf("request item: %s", err))
+			continue
+		}
+		h.Item = res.Item
+		h.Status = res.Status
+
+		if rerr := res.Item.Error; rerr.Type != "" {
+			h.Problems = append(h.Problems, fmt.Sprintf("item error: %s %s %s", rerr.Type, rerr.Code, rerr.Message))
+		}
+
+		if expiration := res.Item.ConsentExpirationTime; !expiration.IsZero() {
+			if expiration.Before(now) {
+				h.Problems = append(h.Problems, fmt.Sprintf("consent expired at %s", expiration.Format(time.RFC3339)))
+			} else if expiration.Sub(now) < consentExpirationWarning {
+				h.Problems = append(h.Problems, fmt.Sprintf("consent expires at %s", expiration.Format(time.RFC3339)))
+			}
+		}
+
+		transactions := res.Status.Transactions
+		if transactions.LastFailedUpdate.After(transactions.LastSuccessfulUpdate) {
+			h.Problems = append(h.Problems, fmt.Sprintf("last transactions update failed at %s", transactions.LastFailedUpdate.Format(time.RFC3339)))
+		}
+
+		investments := res.Status.Investments
+		if investments.LastFailedUpdate.After(investments.LastSuccessfulUpdate) {
+			h.Problems = append(h.Problems, fmt.Sprintf("last investments update failed at %s", investments.LastFailedUpdate.Format(time.RFC3339)))
+		}
+	}
+
+	return health
+}
@@ -0,0 +1,108 @@
+package ledger
+
+import (
+	"sort"
+	"time"
+)
+
+type TaxBox string
+
+const (
+	BoxA TaxBox = "A" // short-term, basis reported to the IRS
+	BoxB TaxBox = "B" // short-term, basis not reported to the IRS
+	BoxD TaxBox = "D" // long-term, basis reported to the IRS
+	BoxE TaxBox = "E" // long-term, basis not reported to the IRS
+
+	WashSaleCode   = "W"
+	washSaleWindow = 30 // days before and after a sale
+)
+
+type Form8949Entry struct {
+	AccountID      string
+	SecurityID     string
+	SaleID         string
+	Acquired       time.Time
+	Sold           time.Time
+	Quantity       float64
+	Proceeds       float64
+	CostBasis      float64
+	AdjustmentCode string
+	Adjustment     float64
+	Box            TaxBox // empty if the basis is missing, since the term is unknown
+	MissingBasis   bool
+}
+
+func (e Form8949Entry) Gain() float64 {
+	return e.Proceeds - e.CostBasis + e.Adjustment
+}
+
+// Form8949 builds capital gains entries for sales within the tax year. Sales
+// that matched no lot are included with MissingBasis set, so that their basis
+// and box can be entered manually; track lots from earlier history to fill
+// them in. Losses disallowed by wash sales, as found by TrackLots, are
+// reported as adjustments.
+func Form8949(itemConfig *ItemConfig, gains []RealizedGain, year int) []Form8949Entry {
+	noncovered := make(map[string]bool)
+	for _, accountID := range itemConfig.Noncovered {
+		noncovered[accountID] = true
+	}
+
+	sorted := make([]RealizedGain, len(gains))
+	copy(sorted, gains)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Sold.Before(sorted[j].Sold)
+	})
+
+	var entries []Form8949Entry
+	for _, gain := range sorted {
+		if gain.Sold.Year() != year {
+			continue
+		}
+		if gain.MissingBasis {
+			entries = append(entries, Form8949Entry{
+				AccountID:    gain.AccountID,
+				SecurityID:   gain.SecurityID,
+				SaleID:       gain.SaleID,
+				Sold:         gain.Sold,
+				Quantity:     gain.Quantity,
+				Proceeds:     gain.Proceeds,
+				MissingBasis: true,
+			})
+			continue
+		}
+
+		reported := !noncovered[gain.AccountID]
+		var box TaxBox
+		switch {
+		case gain.Term == LongTerm && reported:
+			box = BoxD
+		case gain.Term == LongTerm:
+			box = BoxE
+		case reported:
+			box = BoxA
+		default:
+			box = BoxB
+		}
+
+		entry := Form8949Entry{
+			AccountID:  gain.AccountID,
+			SecurityID: gain.SecurityID,
+			SaleID:     gain.SaleID,
+			Acquired:   gain.Acquired,
+			Sold:       gain.Sold,
+			Quantity:   gain.Quantity,
+			Proceeds:   gain.Proceeds,
+			CostBasis:  gain.CostBasis,
+			Box:        box,
+		}
+
+		if gain.WashSale > 0 {
+			entry.AdjustmentCode = WashSaleCode
+			entry.Adjustment = gain.WashSale
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
@@ -17,6 +17,12 @@ type ItemGetResponse struct {
 	RequestID string     `json:"request_id"`
 }
 
+type AccountsResponse struct {
+	Item      Item      `json:"item"`
+	Accounts  []Account `json:"accounts"`
+	RequestID string    `json:"request_id"`
+}
+
 type RefreshResponse struct {
 	RequestID string `json:"request_id"`
 }
@@ -31,10 +37,11 @@ type TransactionsRequest struct {
 }
 
 type TransactionsRequestOptions struct {
-	Count                      int      `json:"count"` // max 500
-	Offset                     int      `json:"offset"`
-	AccountIDs                 []string `json:"account_ids"`
-	IncludeOriginalDescription bool     `json:"include_original_description"`
+	Count                          int      `json:"count"` // max 500
+	Offset                         int      `json:"offset"`
+	AccountIDs                     []string `json:"account_ids"`
+	IncludeOriginalDescription     bool     `json:"include_original_description"`
+	IncludePersonalFinanceCategory bool     `json:"include_personal_finance_category"`
 }
 
 type TransactionsResponse struct {
@@ -71,6 +78,25 @@ type InvestmentTransactionsResponse struct {
 	IsInvestmentsFallbackItem bool                    `json:"is_investments_fallback_item"`
 }
 
+type HoldingsRequest struct {
+	ClientID    string                 `json:"client_id"`
+	Secret      string                 `json:"secret"`
+	AccessToken string                 `json:"access_token"`
+	Options     HoldingsRequestOptions `json:"options"`
+}
+
+type HoldingsRequestOptions struct {
+	AccountIDs []string `json:"account_ids"`
+}
+
+type HoldingsResponse struct {
+	Item       Item       `json:"item"`
+	Accounts   []Account  `json:"accounts"`
+	Holdings   []Holding  `json:"holdings"`
+	Securities []Security `json:"securities"`
+	RequestID  string     `json:"request_id"`
+}
+
 type Item struct {
 	ID            string `json:"item_id"`
 	InstitutionID string `json:"institution_id"`
@@ -80,8 +106,9 @@ type Item struct {
 	OptionalProducts  []string `json:"optional_products"`
 	Products          []string `json:"products"`
 
-	UpdateType string   `json:"update_type"`
-	Error      APIError `json:"error"`
+	UpdateType            string    `json:"update_type"`
+	ConsentExpirationTime time.Time `json:"consent_expiration_time"`
+	Error                 APIError  `json:"error"`
 }
 
 type ItemStatus struct {
@@ -143,15 +170,32 @@ type Security struct {
 	IsCashEquivalent bool   `json:"is_cash_equivalent"`
 	Type             string `json:"type"`
 
-	ClosePrice           float64   `json:"close_price"`
-	ClosePriceAsOf       Date      `json:"close_price_as_of"`
-	UpdateDatetime       time.Time `json:"update_datetime"`
-	ISOCurrency          string    `json:"iso_currency_code"`
-	UnofficialCurrency   string    `json:"unofficial_currency_code"`
-	MarketIdentifierCode string    `json:"market_identifier_code"`
-	Sector               string    `json:"sector"`
-	Industry             string    `json:"industry"`
-	// OptionContract OptionContract `json:"option_contract"`
+	ClosePrice           float64         `json:"close_price"`
+	ClosePriceAsOf       Date            `json:"close_price_as_of"`
+	UpdateDatetime       time.Time       `json:"update_datetime"`
+	ISOCurrency          string          `json:"iso_currency_code"`
+	UnofficialCurrency   string          `json:"unofficial_currency_code"`
+	MarketIdentifierCode string          `json:"market_identifier_code"`
+	Sector               string          `json:"sector"`
+	Industry             string          `json:"industry"`
+	OptionContract       *OptionContract `json:"option_contract"` // nil unless the security is an option
+
+	symbol string // configured commodity symbol, see Config.MapSecurities
+}
+
+// Symbol returns the security's configured symbol, falling back to its ticker.
+func (s Security) Symbol() string {
+	if s.symbol != "" {
+		return s.symbol
+	}
+	return s.TickerSymbol
+}
+
+type OptionContract struct {
+	ContractType             string  `json:"contract_type"` // "call" or "put"
+	ExpirationDate           Date    `json:"expiration_date"`
+	StrikePrice              float64 `json:"strike_price"`
+	UnderlyingSecurityTicker string  `json:"underlying_security_ticker"`
 }
 
 type Holding struct {
@@ -182,13 +226,14 @@ type Transaction struct {
 	UnofficialCurrency string  `json:"unofficial_currency_code"`
 	CheckNumber        string  `json:"check_number"`
 
-	CategoryID string   `json:category_id"`
-	Category   []string `json:"category"`
+	CategoryID              string                  `json:"category_id"`
+	Category                []string                `json:"category"`
+	PersonalFinanceCategory PersonalFinanceCategory `json:"personal_finance_category"`
 
 	Date           Date      `json:"date"`
 	Time           time.Time `json:"datetime"`
 	AuthorizedDate Date      `json:"authorized_date"`
-	AuthorizedTime time.Time `json:"authorized_time"`
+	AuthorizedTime time.Time `json:"authorized_datetime"`
 	Location       Location  `json:"location"`
 
 	OriginalDescription string      `json:"original_description"`
@@ -207,14 +252,14 @@ type InvestmentTransaction struct {
 	AccountID  string `json:"account_id"`
 	SecurityID string `json:"security_id"`
 
-	Date     Date    `json:"date"`
-	Name     string  `json:"name"`
-	Quantity float64 `json:"quantity"`
-	Amount   float64 `json:"amount"`
-	Price    float64 `json:"price"`
-	Fees     float64 `json:"fees"`
-	Type     string  `json:"type"`
-	Subtype  string  `json:"subtype"`
+	Date     Date              `json:"date"`
+	Name     string            `json:"name"`
+	Quantity float64           `json:"quantity"`
+	Amount   float64           `json:"amount"`
+	Price    float64           `json:"price"`
+	Fees     float64           `json:"fees"`
+	Type     InvestmentType    `json:"type"`
+	Subtype  InvestmentSubtype `json:"subtype"`
 
 	ISOCurrency        string `json:"iso_currency_code"`
 	UnofficialCurrency string `json:"unofficial_currency_code"`
@@ -231,6 +276,15 @@ func (d Date) Format(layout string) string {
 	return d.Time.Format(layout)
 }
 
+// In returns the same calendar date at midnight in loc. Plaid dates carry no
+// time zone, so they are unmarshaled as UTC.
+func (d Date) In(loc *time.Location) Date {
+	if d.Time.IsZero() {
+		return d
+	}
+	return Date{time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)}
+}
+
 func (d *Date) UnmarshalJSON(b []byte) error {
 	var tmp string
 	err := json.Unmarshal(b, &tmp)
@@ -248,6 +302,12 @@ func (d *Date) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+type PersonalFinanceCategory struct {
+	Primary         string `json:"primary"`
+	Detailed        string `json:"detailed"`
+	ConfidenceLevel string `json:"confidence_level"` // VERY_HIGH, HIGH, MEDIUM, LOW or UNKNOWN
+}
+
 type Location struct {
 	Address     string  `json:"address"`
 	City        string  `json:"city"`
@@ -0,0 +1,182 @@
+package ledger
+
+import (
+	"math"
+	"sort"
+)
+
+const DefaultTransferTolerance = 3 // days
+
+// transfer categories in plaid's category hierarchy; credit card payments are
+// categorized as payments rather than transfers
+var transferCategories = map[string]bool{
+	"Transfer": true,
+	"Payment":  true,
+}
+
+// transfer categories in the personal finance taxonomy, by primary or
+// detailed category
+var transferPersonalFinanceCategories = map[string]bool{
+	"TRANSFER_IN":                       true,
+	"TRANSFER_OUT":                      true,
+	"LOAN_PAYMENTS_CREDIT_CARD_PAYMENT": true,
+}
+
+// Transfer is a pair of transactions moving money between two configured
+// accounts, such as a credit card payment from checking
+type Transfer struct {
+	ID      string // ID of the outflow transaction
+	Outflow TransferLeg
+	Inflow  TransferLeg
+}
+
+type TransferLeg struct {
+	ItemID      string
+	Account     string // configured account name
+	Transaction Transaction
+}
+
+type transferCandidate struct {
+	outflow TransferLeg
+	inflow  TransferLeg
+	score   int
+	days    float64
+}
+
+// MatchTransfers pairs transactions of opposite amounts in different
+// configured accounts, posted within tolerance days of each other. Pairs must
+// also share payment meta or have a transfer category on at least one side,
+// and the best supported pairs are matched first. Pending transactions are
+// not matched.
+func MatchTransfers(config *Config, activity []*ItemData, tolerance int) []Transfer {
+	var outflows, inflows []TransferLeg
+	for _, item := range activity {
+		itemConfig, ok := config.Items[item.ID]
+		if !ok {
+			continue
+		}
+
+		for _, transaction := range item.Transactions {
+			account, ok := itemConfig.Transactions[transaction.AccountID]
+			if !ok || transaction.Pending || transaction.Amount == 0 {
+				continue
+			}
+
+			leg := TransferLeg{
+				ItemID:      item.ID,
+				Account:     account,
+				Transaction: transaction,
+			}
+			if transaction.Amount > 0 {
+				outflows = append(outflows, leg)
+			} else {
+				inflows = append(inflows, leg)
+			}
+		}
+	}
+
+	var candidates []transferCandidate
+	for _, outflow := range outflows {
+		for _, inflow := range inflows {
+			if outflow.Transaction.AccountID == inflow.Transaction.AccountID {
+				continue
+			}
+			if math.Abs(outflow.Transaction.Amount+inflow.Transaction.Amount) > 0.005 {
+				continue
+			}
+
+			days := math.Abs(TransactionDate(outflow.Transaction).Sub(TransactionDate(inflow.Transaction)).Hours()) / 24
+			if days > float64(tolerance) {
+				continue
+			}
+
+			score := transferScore(outflow.Transaction, inflow.Transaction)
+			if score == 0 {
+				continue
+			}
+
+			candidates = append(candidates, transferCandidate{
+				outflow: outflow,
+				inflow:  inflow,
+				score:   score,
+				days:    days,
+			})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.days != b.days {
+			return a.days < b.days
+		}
+		if a.outflow.Transaction.ID != b.outflow.Transaction.ID {
+			return a.outflow.Transaction.ID < b.outflow.Transaction.ID
+		}
+		return a.inflow.Transaction.ID < b.inflow.Transaction.ID
+	})
+
+	matched := make(map[string]bool)
+	var transfers []Transfer
+	for _, candidate := range candidates {
+		outflowID, inflowID := candidate.outflow.Transaction.ID, candidate.inflow.Transaction.ID
+		if matched[outflowID] || matched[inflowID] {
+			continue
+		}
+		matched[outflowID] = true
+		matched[inflowID] = true
+
+		transfers = append(transfers, Transfer{
+			ID:      outflowID,
+			Outflow: candidate.outflow,
+			Inflow:  candidate.inflow,
+		})
+	}
+
+	return transfers
+}
+
+// transferScore counts the evidence beyond amount and date that two
+// transactions are a transfer
+func transferScore(outflow, inflow Transaction) int {
+	var score int
+	for _, transaction := range []Transaction{outflow, inflow} {
+		pfc := transaction.PersonalFinanceCategory
+		if len(transaction.Category) > 0 && transferCategories[transaction.Category[0]] {
+			score += 1
+		} else if transferPersonalFinanceCategories[pfc.Primary] || transferPersonalFinanceCategories[pfc.Detailed] {
+			score += 1
+		}
+	}
+
+	outflowMeta, inflowMeta := outflow.PaymentMeta, inflow.PaymentMeta
+	if outflowMeta.ReferenceNumber != "" && outflowMeta.ReferenceNumber == inflowMeta.ReferenceNumber {
+		score += 2
+	}
+	if outflowMeta.PPDID != "" && outflowMeta.PPDID == inflowMeta.PPDID {
+		score += 2
+	}
+
+	return score
+}
+
+// TransfersByTransaction indexes transfers by the IDs of both their
+// transactions
+func TransfersByTransaction(transfers []Transfer) map[string]Transfer {
+	index := make(map[string]Transfer, len(transfers)*2)
+	for _, transfer := range transfers {
+		index[transfer.Outflow.Transaction.ID] = transfer
+		index[transfer.Inflow.Transaction.ID] = transfer
+	}
+	return index
+}
+
+// counterpart returns the other leg of the transfer
+func (t Transfer) counterpart(transactionID string) TransferLeg {
+	if t.Outflow.Transaction.ID == transactionID {
+		return t.Inflow
+	}
+	return t.Outflow
+}
@@ -0,0 +1,180 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+)
+
+type UnmappedPolicy string
+
+const (
+	UnmappedFail     UnmappedPolicy = "fail"
+	UnmappedSkip     UnmappedPolicy = "skip"
+	UnmappedFallback UnmappedPolicy = "fallback"
+
+	DefaultUnmappedPolicy         = UnmappedFail
+	DefaultFallbackAccountFormat  = "Unknown:%s" // formatted with the account mask
+	DefaultFallbackSecurityFormat = "Unknown:%s" // formatted with the security ID
+
+	unmappedAccount  = "account"
+	unmappedSecurity = "security"
+)
+
+func ParseUnmappedPolicy(policy string) (UnmappedPolicy, error) {
+	switch p := UnmappedPolicy(policy); p {
+	case UnmappedFail, UnmappedSkip, UnmappedFallback:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown unmapped policy: %q", policy)
+	}
+}
+
+type UnmappedRecord struct {
+	Item     string // item name
+	Kind     string // account or security
+	ID       string
+	RoutedTo string // empty if skipped
+	Count    int
+}
+
+// UnmappedLog collects the accounts and securities that were skipped or routed
+// to a fallback while writing. Records are counted once however many outputs
+// they're written to.
+type UnmappedLog struct {
+	records map[UnmappedRecord]map[string]bool // IDs of records per account or security
+}
+
+func NewUnmappedLog() *UnmappedLog {
+	return &UnmappedLog{
+		records: make(map[UnmappedRecord]map[string]bool),
+	}
+}
+
+func (l *UnmappedLog) add(item, kind, id, routedTo, recordID string) {
+	if l == nil {
+		return
+	}
+
+	key := UnmappedRecord{Item: item, Kind: kind, ID: id, RoutedTo: routedTo}
+	if l.records[key] == nil {
+		l.records[key] = make(map[string]bool)
+	}
+	l.records[key][recordID] = true
+}
+
+func (l *UnmappedLog) Records() []UnmappedRecord {
+	if l == nil {
+		return nil
+	}
+
+	records := make([]UnmappedRecord, 0, len(l.records))
+	for record, ids := range l.records {
+		record.Count = len(ids)
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Item != b.Item {
+			return a.Item < b.Item
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+
+	return records
+}
+
+// accountName looks up an account's configured name, applying the unmapped
+// policy if it isn't configured. The record should be skipped if ok is false.
+func (o *WriteOptions) accountName(itemConfig *ItemConfig, names map[string]string, item *ItemData, accountID, recordID string) (string, bool, error) {
+	if name, ok := names[accountID]; ok {
+		return name, true, nil
+	}
+
+	switch o.UnmappedPolicy {
+	case UnmappedSkip:
+		o.Unmapped.add(itemConfig.Name, unmappedAccount, accountID, "", recordID)
+		return "", false, nil
+	case UnmappedFallback:
+		mask := accountID
+		if account, ok := item.Accounts[accountID]; ok && account.Mask != "" {
+			mask = account.Mask
+		}
+		name := fmt.Sprintf(o.FallbackAccountFormat, mask)
+		o.Unmapped.add(itemConfig.Name, unmappedAccount, accountID, name, recordID)
+		return name, true, nil
+	default:
+		return "", false, fmt.Errorf("unknown account: %q", accountID)
+	}
+}
+
+// security looks up a security by ID, applying the unmapped policy if the
+// item has no such security. The record should be skipped if ok is false.
+func (o *WriteOptions) security(itemConfig *ItemConfig, item *ItemData, securityID, recordID string) (Security, bool, error) {
+	if security, ok := item.Securities[securityID]; ok {
+		return security, true, nil
+	}
+
+	switch o.UnmappedPolicy {
+	case UnmappedSkip:
+		o.Unmapped.add(itemConfig.Name, unmappedSecurity, securityID, "", recordID)
+		return Security{}, false, nil
+	case UnmappedFallback:
+		name := fmt.Sprintf(o.FallbackSecurityFormat, securityID)
+		o.Unmapped.add(itemConfig.Name, unmappedSecurity, securityID, name, recordID)
+		return Security{ID: securityID, Name: name}, true, nil
+	default:
+		return Security{}, false, fmt.Errorf("unknown security: %q", securityID)
+	}
+}
+
+// CheckUnmapped returns an error for the first unmapped account or security in
+// item's records or gains if the unmapped policy is fail, so that every item
+// can be checked before any output is written
+func CheckUnmapped(itemConfig *ItemConfig, item *ItemData, gains []RealizedGain, options *WriteOptions) error {
+	if options.UnmappedPolicy != UnmappedFail {
+		return nil
+	}
+
+	for _, transaction := range item.Transactions {
+		if options.OmitPending && transaction.Pending {
+			continue
+		}
+		if _, ok := itemConfig.Transactions[transaction.AccountID]; !ok {
+			return fmt.Errorf("unknown account: %q", transaction.AccountID)
+		}
+	}
+
+	for _, transaction := range item.Investments {
+		security, ok := item.Securities[transaction.SecurityID]
+		switch transaction.output(security) {
+		case outputTransactions:
+			// cash movements often have no security
+			if transaction.SecurityID != "" && !ok {
+				return fmt.Errorf("unknown security: %q", transaction.SecurityID)
+			}
+		case outputInvestments:
+			if !ok {
+				return fmt.Errorf("unknown security: %q", transaction.SecurityID)
+			}
+		default:
+			continue
+		}
+		if _, ok := itemConfig.Investments[transaction.AccountID]; !ok {
+			return fmt.Errorf("unknown account: %q", transaction.AccountID)
+		}
+	}
+
+	for _, gain := range gains {
+		if _, ok := item.Securities[gain.SecurityID]; !ok {
+			return fmt.Errorf("unknown security: %q", gain.SecurityID)
+		}
+		if _, ok := itemConfig.Investments[gain.AccountID]; !ok {
+			return fmt.Errorf("unknown account: %q", gain.AccountID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var knownEnvironments = map[string]bool{
+	"sandbox":     true,
+	"development": true,
+	"production":  true,
+}
+
+// ValidateConfig checks raw config data for problems that LoadConfig doesn't
+// catch, returning a description of each problem found
+func ValidateConfig(data []byte) []string {
+	var problems []string
+
+	configs := make(map[string]*Config)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(configs)
+	if err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return []string{fmt.Sprintf("decode config: %s", err)}
+		}
+		// decoding continues past unknown fields, so report them and
+		// check the rest
+		problems = append(problems, typeErr.Errors...)
+	}
+
+	if len(configs) == 0 {
+		problems = append(problems, "no environments configured")
+	}
+
+	environments := make([]string, 0, len(configs))
+	for environment := range configs {
+		environments = append(environments, environment)
+	}
+	sort.Strings(environments)
+
+	for _, environment := range environments {
+		config := configs[environment]
+		if config == nil {
+			problems = append(problems, fmt.Sprintf("%s: empty environment", environment))
+			continue
+		}
+		problems = append(problems, config.validate(environment)...)
+	}
+
+	return problems
+}
+
+func (c *Config) validate(environment string) []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, environment+": "+fmt.Sprintf(format, args...))
+	}
+
+	if !knownEnvironments[environment] && c.BaseURL == "" {
+		problem("unknown plaid environment")
+	}
+	if c.ClientID == "" {
+		problem("client_id is empty")
+	}
+	switch countSources(c.Secret, c.SecretEnv, c.SecretFile, c.SecretCommand) {
+	case 0:
+		problem("no secret, secret_env, secret_file or secret_command")
+	case 1:
+	default:
+		problem("more than one of secret, secret_env, secret_file and secret_command")
+	}
+	if len(c.Items) == 0 {
+		problem("no items configured")
+	}
+	if _, err := c.Location(); err != nil {
+		problem("time_zone: %s", err)
+	}
+	if c.FiscalYearStart < 0 || c.FiscalYearStart > time.December {
+		problem("fiscal_year_start: must be a month number from 1 to 12")
+	}
+	for _, columns := range [][]ColumnConfig{c.Columns.Transactions, c.Columns.Investments} {
+		if len(columns) == 0 {
+			continue
+		}
+		if _, err := NewColumns(columns, NewWriteOptions()); err != nil {
+			problem("columns: %s", err)
+		}
+	}
+	if _, err := ParseCategoryTaxonomy(string(c.CategoryTaxonomy)); err != nil {
+		problem("category_taxonomy: %s", err)
+	}
+	if _, err := NewPayee(c.Payee); err != nil {
+		problem("payee: %s", err)
+	}
+	securityIDs := make([]string, 0, len(c.Securities))
+	for id := range c.Securities {
+		securityIDs = append(securityIDs, id)
+	}
+	sort.Strings(securityIDs)
+	for _, id := range securityIDs {
+		mapping := c.Securities[id]
+		if mapping.Symbol == "" && mapping.Name == "" {
+			problem("securities: %q: no symbol or name", id)
+		} else if strings.ContainsAny(mapping.Symbol, " \t\"") {
+			problem("securities: %q: symbol %q contains whitespace or quotes", id, mapping.Symbol)
+		}
+	}
+	dialects := map[string]*Dialect{
+		"default":      &c.CSV.Dialect,
+		"transactions": c.CSV.Transactions,
+		"investments":  c.CSV.Investments,
+		"gains":        c.CSV.Gains,
+		"form_8949":    c.CSV.Form8949,
+		"prices":       c.CSV.Prices,
+	}
+	for _, output := range sortedKeys(dialects) {
+		if dialect := dialects[output]; dialect != nil {
+			if err := dialect.validate(); err != nil {
+				problem("csv %s: %s", output, err)
+			}
+		}
+	}
+	for i, budget := range c.Budgets {
+		if err := budget.Validate(); err != nil {
+			problem("budget %d: %s", i, err)
+		}
+	}
+
+	itemIDs := make([]string, 0, len(c.Items))
+	for itemID := range c.Items {
+		itemIDs = append(itemIDs, itemID)
+	}
+	sort.Strings(itemIDs)
+
+	accountItems := make(map[string]string) // map account ID to item ID
+	for _, itemID := range itemIDs {
+		itemConfig := c.Items[itemID]
+		if itemConfig == nil {
+			problem("item %q: empty item", itemID)
+			continue
+		}
+
+		if itemConfig.Name == "" {
+			problem("item %q: name is empty", itemID)
+		}
+		switch countSources(itemConfig.Token, itemConfig.TokenEnv, itemConfig.TokenFile, itemConfig.TokenCommand) {
+		case 0:
+			problem("item %q: no token, token_env, token_file or token_command", itemID)
+		case 1:
+		default:
+			problem("item %q: more than one of token, token_env, token_file and token_command", itemID)
+		}
+		if len(itemConfig.Transactions) == 0 && len(itemConfig.Investments) == 0 {
+			problem("item %q: no transactions or investments accounts", itemID)
+		}
+
+		for _, accounts := range []map[string]string{itemConfig.Transactions, itemConfig.Investments} {
+			for _, accountID := range sortedKeys(accounts) {
+				if accounts[accountID] == "" {
+					problem("item %q: account %q: name is empty", itemID, accountID)
+				}
+
+				if other, ok := accountItems[accountID]; ok && other != itemID {
+					problem("item %q: account %q: also configured for item %q", itemID, accountID, other)
+				}
+				accountItems[accountID] = itemID
+			}
+		}
+
+		for _, accountID := range sortedKeys(itemConfig.Transactions) {
+			if _, ok := itemConfig.Investments[accountID]; ok {
+				problem("item %q: account %q: listed in both transactions and investments", itemID, accountID)
+			}
+		}
+
+		for _, accountID := range itemConfig.Noncovered {
+			if _, ok := itemConfig.Investments[accountID]; !ok {
+				problem("item %q: noncovered account %q: not an investments account", itemID, accountID)
+			}
+		}
+	}
+
+	return problems
+}
+
+// VerifyConfig checks a loaded config against plaid, ensuring that each
+// item's token is accepted and each configured account exists
+func VerifyConfig(config *Config) []string {
+	var problems []string
+	for _, itemID := range sortedKeys(config.Items) {
+		itemConfig := config.Items[itemID]
+		res, err := requestAccounts(config, itemConfig)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: item %q: request accounts: %s", config.Environment, itemID, err))
+			continue
+		}
+
+		if res.Item.ID != "" && res.Item.ID != itemID {
+			problems = append(problems, fmt.Sprintf("%s: item %q: token belongs to item %q", config.Environment, itemID, res.Item.ID))
+		}
+
+		accounts := make(map[string]Account, len(res.Accounts))
+		for _, account := range res.Accounts {
+			accounts[account.ID] = account
+		}
+
+		for _, accountID := range sortedKeys(itemConfig.Transactions) {
+			if _, ok := accounts[accountID]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: item %q: transactions account %q: not found", config.Environment, itemID, accountID))
+			}
+		}
+		for _, accountID := range sortedKeys(itemConfig.Investments) {
+			account, ok := accounts[accountID]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: item %q: investments account %q: not found", config.Environment, itemID, accountID))
+			} else if !IsInvestmentAccount(account) {
+				problems = append(problems, fmt.Sprintf("%s: item %q: investments account %q: has type %q", config.Environment, itemID, accountID, account.Type))
+			}
+		}
+	}
+
+	return problems
+}
+
+func countSources(sources ...string) int {
+	var count int
+	for _, source := range sources {
+		if source != "" {
+			count += 1
+		}
+	}
+	return count
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
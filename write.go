@@ -1,9 +1,9 @@
 package ledger
 
 import (
-	"encoding/csv"
 	"fmt"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,6 +13,8 @@ const (
 	DefaultAmountFormat         = "%0.2f"
 	DefaultCommodityPriceFormat = "%g"
 	DefaultCategoryDelimiter    = "."
+	DefaultTaxDateFormat        = "01/02/2006"
+	DefaultDatetimeFormat       = time.RFC3339
 )
 
 type WriteOptions struct {
@@ -22,6 +24,24 @@ type WriteOptions struct {
 	AmountFormat         string
 	CommodityPriceFormat string
 	CategoryDelimiter    string
+	CategoryTaxonomy     CategoryTaxonomy
+	TaxDateFormat        string
+	DatetimeFormat       string
+	Location             *time.Location // time zone for datetimes; UTC if nil
+	Dialect              Dialect
+
+	TransactionColumns *Columns // DefaultTransactionColumns if nil
+	InvestmentColumns  *Columns // DefaultInvestmentColumns if nil
+
+	Payee     *Payee              // DefaultPayeeFields without normalization if nil
+	Transfers map[string]Transfer // matched transfers by transaction ID
+
+	UnmappedPolicy         UnmappedPolicy
+	FallbackAccountFormat  string
+	FallbackSecurityFormat string
+	Unmapped               *UnmappedLog
+
+	JournalIDKey string // metadata key for transaction IDs in journal output
 }
 
 func NewWriteOptions() *WriteOptions {
@@ -32,24 +52,86 @@ func NewWriteOptions() *WriteOptions {
 		AmountFormat:         DefaultAmountFormat,
 		CommodityPriceFormat: DefaultCommodityPriceFormat,
 		CategoryDelimiter:    DefaultCategoryDelimiter,
+		CategoryTaxonomy:     DefaultCategoryTaxonomy,
+		TaxDateFormat:        DefaultTaxDateFormat,
+		DatetimeFormat:       DefaultDatetimeFormat,
+		Location:             time.UTC,
+		Dialect:              NewDialect(),
+		Payee:                defaultPayee(),
+
+		UnmappedPolicy:         DefaultUnmappedPolicy,
+		FallbackAccountFormat:  DefaultFallbackAccountFormat,
+		FallbackSecurityFormat: DefaultFallbackSecurityFormat,
+		Unmapped:               NewUnmappedLog(),
+
+		JournalIDKey: DefaultJournalIDKey,
+	}
+}
+
+func (o *WriteOptions) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+func (o *WriteOptions) formatDatetime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(o.location()).Format(o.DatetimeFormat)
+}
+
+func (o *WriteOptions) payee(transaction Transaction) string {
+	if o.Payee == nil {
+		return defaultPayee().Derive(transaction)
 	}
+	return o.Payee.Derive(transaction)
 }
 
-func WriteTransactions(itemConfig *ItemConfig, output *csv.Writer, item *ItemData, options *WriteOptions) (error, int) {
+func (o *WriteOptions) formatAmount(amount float64) string {
+	return o.Dialect.decimal(fmt.Sprintf(o.AmountFormat, amount))
+}
+
+func (o *WriteOptions) formatPrice(price float64) string {
+	return o.Dialect.decimal(fmt.Sprintf(o.CommodityPriceFormat, price))
+}
+
+func (o *WriteOptions) formatQuantity(quantity float64) string {
+	return o.Dialect.decimal(fmt.Sprint(quantity))
+}
+
+func (o *WriteOptions) transactionColumns() (*Columns, error) {
+	if o.TransactionColumns != nil {
+		return o.TransactionColumns, nil
+	}
+	return NewColumns(DefaultTransactionColumns, o)
+}
+
+func (o *WriteOptions) investmentColumns() (*Columns, error) {
+	if o.InvestmentColumns != nil {
+		return o.InvestmentColumns, nil
+	}
+	return NewColumns(DefaultInvestmentColumns, o)
+}
+
+func WriteTransactions(itemConfig *ItemConfig, output RecordWriter, item *ItemData, options *WriteOptions) (error, int) {
+	columns, err := options.transactionColumns()
+	if err != nil {
+		return fmt.Errorf("compile columns: %w", err), 0
+	}
+
 	var count int
 	for _, transaction := range item.Transactions {
 		if options.OmitPending && transaction.Pending {
 			continue
 		}
 
-		payee := transaction.MerchantName
-		if transaction.Name != "" {
-			payee = transaction.Name
-		}
-
-		accountName, ok := itemConfig.Transactions[transaction.AccountID]
-		if !ok {
-			return fmt.Errorf("unknown account: %q", transaction.AccountID), count
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Transactions, item, transaction.AccountID, transaction.ID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
 		}
 
 		currency := transaction.ISOCurrency
@@ -57,42 +139,55 @@ func WriteTransactions(itemConfig *ItemConfig, output *csv.Writer, item *ItemDat
 			currency = transaction.UnofficialCurrency
 		}
 
+		data := TransactionRecord{
+			Transaction: transaction,
+			Account:     accountName,
+			ItemName:    itemConfig.Name,
+			Payee:       options.payee(transaction),
+			Currency:    currency,
+			Category:    strings.Join(transaction.Categories(options.CategoryTaxonomy), options.CategoryDelimiter),
+		}
+		if transfer, ok := options.Transfers[transaction.ID]; ok {
+			data.TransferID = transfer.ID
+			data.TransferAccount = transfer.counterpart(transaction.ID).Account
+		}
+
+		record, err := columns.Record(data)
+		if err != nil {
+			return fmt.Errorf("format record: %w", err), count
+		}
+
 		count += 1
-		output.Write([]string{
-			transaction.Date.Format(options.PostDateFormat),
-			transaction.AuthorizedDate.Format(options.AuthDateFormat),
-			accountName,
-			itemConfig.Name,
-			transaction.CheckNumber,
-			payee,
-			fmt.Sprintf(options.AmountFormat, transaction.Amount),
-			currency,
-			strings.Join(transaction.Category, options.CategoryDelimiter),
-			transaction.ID,
-		})
+		output.Write(record)
 		if err := output.Error(); err != nil {
 			return fmt.Errorf("write record: %w", err), count
 		}
 	}
 
 	for _, transaction := range item.Investments {
-		// FIXME: turn these into constants
-		if transaction.Type != "cash" && transaction.Type != "fee" {
-			continue
-		}
-		if transaction.Subtype == "stock distribution" {
-			// the only non-currency cash subtype
+		known := item.Securities[transaction.SecurityID]
+		if transaction.output(known) != outputTransactions {
 			continue
 		}
+		transaction = transaction.normalize(known)
 
-		security, ok := item.Securities[transaction.SecurityID]
-		if !ok {
-			return fmt.Errorf("unknown security: %q", transaction.SecurityID), count
+		// cash movements often have no security
+		payee := transaction.Name
+		if transaction.SecurityID != "" {
+			security, ok, err := options.security(itemConfig, item, transaction.SecurityID, transaction.ID)
+			if err != nil {
+				return err, count
+			} else if !ok {
+				continue
+			}
+			payee = security.Name
 		}
 
-		accountName, ok := itemConfig.Investments[transaction.AccountID]
-		if !ok {
-			return fmt.Errorf("unknown account: %q", transaction.AccountID), count
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Investments, item, transaction.AccountID, transaction.ID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
 		}
 
 		currency := transaction.ISOCurrency
@@ -100,19 +195,31 @@ func WriteTransactions(itemConfig *ItemConfig, output *csv.Writer, item *ItemDat
 			currency = transaction.UnofficialCurrency
 		}
 
-		count += 1
-		output.Write([]string{
-			transaction.Date.Format(options.PostDateFormat),
-			"",
-			accountName,
-			itemConfig.Name,
-			"",
-			security.Name,
-			fmt.Sprintf(options.AmountFormat, transaction.Amount),
-			currency,
-			fmt.Sprintf("%s.%s", transaction.Type, transaction.Subtype),
-			transaction.ID,
+		record, err := columns.Record(TransactionRecord{
+			Transaction: Transaction{
+				ID:                 transaction.ID,
+				AccountID:          transaction.AccountID,
+				Amount:             transaction.Amount,
+				ISOCurrency:        transaction.ISOCurrency,
+				UnofficialCurrency: transaction.UnofficialCurrency,
+				Date:               transaction.Date,
+				Name:               transaction.Name,
+			},
+			Account:  accountName,
+			ItemName: itemConfig.Name,
+			Payee:    payee,
+			Currency: currency,
+			Category: fmt.Sprintf("%s.%s", transaction.Type, transaction.Subtype),
 		})
+		if err != nil {
+			return fmt.Errorf("format record: %w", err), count
+		}
+
+		count += 1
+		output.Write(record)
+		if err := output.Error(); err != nil {
+			return fmt.Errorf("write record: %w", err), count
+		}
 	}
 
 	output.Flush()
@@ -123,27 +230,36 @@ func WriteTransactions(itemConfig *ItemConfig, output *csv.Writer, item *ItemDat
 	return nil, count
 }
 
-func WriteInvestments(itemConfig *ItemConfig, output *csv.Writer, item *ItemData, options *WriteOptions) (error, int) {
+func WriteInvestments(itemConfig *ItemConfig, output RecordWriter, item *ItemData, options *WriteOptions) (error, int) {
+	columns, err := options.investmentColumns()
+	if err != nil {
+		return fmt.Errorf("compile columns: %w", err), 0
+	}
+
 	var count int
 	for _, transaction := range item.Investments {
-		if transaction.Type == "cash" || transaction.Type == "fee" {
-			// non-security transaction types
+		if transaction.output(item.Securities[transaction.SecurityID]) != outputInvestments {
 			continue
 		}
 
-		security, ok := item.Securities[transaction.SecurityID]
-		if !ok {
-			return fmt.Errorf("unknown security: %q", transaction.SecurityID), count
+		security, ok, err := options.security(itemConfig, item, transaction.SecurityID, transaction.ID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
 		}
+		transaction = transaction.normalize(security)
 
 		currency := transaction.ISOCurrency
 		if transaction.UnofficialCurrency != "" {
 			currency = transaction.UnofficialCurrency
 		}
 
-		accountName, ok := itemConfig.Investments[transaction.AccountID]
-		if !ok {
-			return fmt.Errorf("unknown account: %q", transaction.AccountID), count
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Investments, item, transaction.AccountID, transaction.ID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
 		}
 
 		category := fmt.Sprintf("%s.%s", security.Sector, security.Industry)
@@ -151,20 +267,134 @@ func WriteInvestments(itemConfig *ItemConfig, output *csv.Writer, item *ItemData
 			category = "unknown"
 		}
 
+		record, err := columns.Record(InvestmentRecord{
+			InvestmentTransaction: transaction,
+			Security:              security,
+			Account:               accountName,
+			ItemName:              itemConfig.Name,
+			Currency:              currency,
+			Category:              category,
+		})
+		if err != nil {
+			return fmt.Errorf("format record: %w", err), count
+		}
+
+		count += 1
+		output.Write(record)
+		if err := output.Error(); err != nil {
+			return fmt.Errorf("write record: %w", err), count
+		}
+	}
+
+	output.Flush()
+	if err := output.Error(); err != nil {
+		return fmt.Errorf("flush output: %w", err), count
+	}
+
+	return nil, count
+}
+
+func WriteRealizedGains(itemConfig *ItemConfig, output RecordWriter, item *ItemData, gains []RealizedGain, options *WriteOptions) (error, int) {
+	var count int
+	for _, gain := range gains {
+		security, ok, err := options.security(itemConfig, item, gain.SecurityID, gain.SaleID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
+		}
+
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Investments, item, gain.AccountID, gain.SaleID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
+		}
+
+		// an unknown basis is left blank rather than reported as zero
+		var basis, realized string
+		if !gain.MissingBasis {
+			basis = options.formatAmount(gain.CostBasis)
+			realized = options.formatAmount(gain.Gain())
+		}
+
 		count += 1
 		output.Write([]string{
-			transaction.Date.Format(options.PostDateFormat),
+			Date{gain.Sold}.Format(options.PostDateFormat),
+			Date{gain.Acquired}.Format(options.PostDateFormat),
 			accountName,
 			itemConfig.Name,
 			security.Name,
-			fmt.Sprint(transaction.Quantity),
-			fmt.Sprintf(options.AmountFormat, transaction.Amount),
-			fmt.Sprintf(options.CommodityPriceFormat, transaction.Price),
-			transaction.ID,
-			fmt.Sprintf(options.AmountFormat, transaction.Fees),
-			currency,
-			security.TickerSymbol,
-			category,
+			security.Symbol(),
+			options.formatQuantity(gain.Quantity),
+			options.formatAmount(gain.Proceeds),
+			basis,
+			realized,
+			string(gain.Term),
+			gain.SaleID,
+			gain.LotID,
+		})
+		if err := output.Error(); err != nil {
+			return fmt.Errorf("write record: %w", err), count
+		}
+	}
+
+	output.Flush()
+	if err := output.Error(); err != nil {
+		return fmt.Errorf("flush output: %w", err), count
+	}
+
+	return nil, count
+}
+
+func WriteForm8949(itemConfig *ItemConfig, output RecordWriter, item *ItemData, entries []Form8949Entry, options *WriteOptions) (error, int) {
+	var count int
+	for _, entry := range entries {
+		security, ok, err := options.security(itemConfig, item, entry.SecurityID, entry.SaleID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
+		}
+
+		accountName, ok, err := options.accountName(itemConfig, itemConfig.Investments, item, entry.AccountID, entry.SaleID)
+		if err != nil {
+			return err, count
+		} else if !ok {
+			continue
+		}
+
+		description := fmt.Sprintf("%s sh %s", options.formatQuantity(entry.Quantity), security.Name)
+		if symbol := security.Symbol(); symbol != "" {
+			description = fmt.Sprintf("%s (%s)", description, symbol)
+		}
+
+		var adjustment string
+		if entry.AdjustmentCode != "" {
+			adjustment = options.formatAmount(entry.Adjustment)
+		}
+
+		// an unknown basis is left blank and flagged for manual entry
+		basis, gain, note := options.formatAmount(entry.CostBasis), options.formatAmount(entry.Gain()), ""
+		if entry.MissingBasis {
+			basis, gain, note = "", "", "unknown cost basis; enter manually"
+		}
+
+		count += 1
+		output.Write([]string{
+			description,
+			Date{entry.Acquired}.Format(options.TaxDateFormat),
+			Date{entry.Sold}.Format(options.TaxDateFormat),
+			options.formatAmount(entry.Proceeds),
+			basis,
+			entry.AdjustmentCode,
+			adjustment,
+			gain,
+			string(entry.Box),
+			accountName,
+			itemConfig.Name,
+			entry.SaleID,
+			note,
 		})
 		if err := output.Error(); err != nil {
 			return fmt.Errorf("write record: %w", err), count